@@ -15,7 +15,8 @@ var stdin io.ReadCloser
 func main() {
 	err := run()
 	if err != nil {
-		log.Fatalf("%v", err)
+		log.Printf("%v", err)
+		os.Exit(exitCode(err))
 	}
 }
 
@@ -40,14 +41,20 @@ func makeApp() *cli.App {
 	return &cli.App{
 		Name:      "Dagu",
 		Usage:     "A No-code workflow executor (DAGs)",
-		UsageText: "dagu [options] <start|status|stop|retry|dry|server> [args]",
+		UsageText: "dagu [options] <start|status|stop|retry|dry|validate|secrets|doctor|server|scheduler> [args]",
 		Commands: []*cli.Command{
 			newStartCommand(),
 			newStatusCommand(),
 			newStopCommand(),
+			newPauseCommand(),
+			newResumeCommand(),
 			newRetryCommand(),
 			newDryCommand(),
+			newValidateCommand(),
+			newSecretsCommand(),
+			newDoctorCommand(),
 			newServerCommand(),
+			newSchedulerCommand(),
 		},
 	}
 }
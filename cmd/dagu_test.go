@@ -26,6 +26,7 @@ var testsDir = path.Join(utils.MustGetwd(), "../tests/testdata")
 
 func TestMain(m *testing.M) {
 	tempDir := utils.MustTempDir("dagu_test")
+	os.Setenv(settings.ConfigExecutable, path.Join(utils.MustGetwd(), "../bin/dagu"))
 	settings.InitTest(tempDir)
 	code := m.Run()
 	os.RemoveAll(tempDir)
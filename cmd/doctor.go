@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/urfave/cli/v2"
+	"github.com/yohamta/dagu/internal/controller"
+	"github.com/yohamta/dagu/internal/database"
+	"github.com/yohamta/dagu/internal/models"
+	"github.com/yohamta/dagu/internal/sock"
+)
+
+func newDoctorCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "doctor",
+		Usage: "dagu doctor",
+		Action: func(c *cli.Context) error {
+			return doctor()
+		},
+	}
+}
+
+// doctor removes the sockets of the agents that are gone and rewrites
+// the statuses of the runs left running by them as failed.
+func doctor() error {
+	count := 0
+	for _, addr := range sock.OrphanedSockets() {
+		if err := os.Remove(addr); err != nil {
+			return err
+		}
+		fmt.Printf("removed orphaned socket: %s\n", addr)
+		count++
+	}
+	db := database.New(database.DefaultConfig())
+	for _, sf := range db.ReadStatusAll() {
+		ok, err := controller.RecoverStaleStatus(sf)
+		if err != nil {
+			return err
+		}
+		if ok {
+			fmt.Printf("marked as failed (%s): %s %s\n",
+				models.ErrAgentTerminated, sf.Status.Name, sf.Status.RequestId)
+			count++
+		}
+	}
+	fmt.Printf("%d problem(s) fixed\n", count)
+	return nil
+}
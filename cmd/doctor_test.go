@@ -0,0 +1,57 @@
+package main
+
+import (
+	"net"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/yohamta/dagu/internal/config"
+	"github.com/yohamta/dagu/internal/database"
+	"github.com/yohamta/dagu/internal/models"
+	"github.com/yohamta/dagu/internal/scheduler"
+	"github.com/yohamta/dagu/internal/sock"
+	"github.com/yohamta/dagu/internal/utils"
+)
+
+func Test_doctorCommand(t *testing.T) {
+	c := testConfig("cmd_doctor.yaml")
+	cl := &config.Loader{HomeDir: utils.MustGetUserHomeDir()}
+	cfg, err := cl.Load(c, "")
+	require.NoError(t, err)
+
+	// the socket of an agent that was killed
+	addr := sock.GetSockAddr(cfg.ConfigPath)
+	l, err := net.Listen("unix", addr)
+	require.NoError(t, err)
+	l.(*net.UnixListener).SetUnlinkOnClose(false)
+	l.Close()
+	require.FileExists(t, addr)
+
+	// the status left running by the agent
+	agent := exec.Command("true")
+	require.NoError(t, agent.Run())
+	db := database.New(database.DefaultConfig())
+	w, _, err := db.NewWriter(cfg.ConfigPath, time.Now(), "")
+	require.NoError(t, err)
+	require.NoError(t, w.Open())
+	st := models.NewStatus(cfg, nil, scheduler.SchedulerStatus_Running,
+		agent.Process.Pid, nil, nil)
+	st.RequestId = "request-id"
+	require.NoError(t, w.Write(st))
+	require.NoError(t, w.Close())
+
+	runAppTestOutput(makeApp(), appTest{
+		args: []string{"", "doctor"}, errored: false,
+		output: []string{
+			"removed orphaned socket: " + addr,
+			"marked as failed (agent terminated unexpectedly): cmd_doctor request-id",
+		},
+	}, t)
+
+	require.NoFileExists(t, addr)
+	s := db.ReadStatusHist(cfg.ConfigPath, 1)
+	require.Equal(t, 1, len(s))
+	require.Equal(t, scheduler.SchedulerStatus_Error, s[0].Status.Status)
+}
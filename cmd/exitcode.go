@@ -0,0 +1,79 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/yohamta/dagu/internal/agent"
+	"github.com/yohamta/dagu/internal/scheduler"
+)
+
+// The exit codes of dagu start and dagu retry.
+const (
+	exitSuccess        = 0
+	exitFailure        = 1
+	exitCanceled       = 2
+	exitSkipped        = 3
+	exitAlreadyRunning = 4
+	exitQueued         = 5
+)
+
+// exitError is an error with the exit code of the process.
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e *exitError) Error() string {
+	return e.err.Error()
+}
+
+func (e *exitError) Unwrap() error {
+	return e.err
+}
+
+// exitCode returns the exit code of the process for the error.
+func exitCode(err error) int {
+	if err == nil {
+		return exitSuccess
+	}
+	var e *exitError
+	if errors.As(err, &e) {
+		return e.code
+	}
+	return exitFailure
+}
+
+// runResult returns the error of the run of the agent with the exit
+// code for the final status of the DAG. It returns nil when the DAG
+// succeeded. A run queued to start later has its own exit code as it
+// has no final status yet.
+func runResult(a *agent.Agent, err error) error {
+	switch {
+	case errors.Is(err, agent.ErrQueued):
+		return &exitError{code: exitQueued, err: err}
+	case errors.Is(err, agent.ErrNotQueued):
+		log.Printf("%s", err)
+		return nil
+	case errors.Is(err, agent.ErrAlreadyRunning):
+		return &exitError{code: exitAlreadyRunning, err: err}
+	case errors.Is(err, agent.ErrPreconditionsNotMet):
+		return &exitError{code: exitSkipped, err: err}
+	}
+	switch a.Status().Status {
+	case scheduler.SchedulerStatus_Success:
+		if err == nil {
+			return nil
+		}
+	case scheduler.SchedulerStatus_Cancel:
+		if err == nil {
+			err = fmt.Errorf("the DAG was canceled")
+		}
+		return &exitError{code: exitCanceled, err: err}
+	}
+	if err == nil {
+		err = fmt.Errorf("the DAG did not finish")
+	}
+	return &exitError{code: exitFailure, err: err}
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"log"
+
+	"github.com/urfave/cli/v2"
+	"github.com/yohamta/dagu/internal/config"
+	"github.com/yohamta/dagu/internal/controller"
+	"github.com/yohamta/dagu/internal/utils"
+)
+
+func newPauseCommand() *cli.Command {
+	cl := &config.Loader{
+		HomeDir: utils.MustGetUserHomeDir(),
+	}
+	return &cli.Command{
+		Name:  "pause",
+		Usage: "dagu pause <config>",
+		Action: func(c *cli.Context) error {
+			configFilePath := c.Args().Get(0)
+			cfg, err := cl.Load(configFilePath, "")
+			if err != nil {
+				return err
+			}
+			return pause(cfg)
+		},
+	}
+}
+
+func pause(cfg *config.Config) error {
+	c := controller.New(cfg)
+	log.Printf("Pausing...")
+	return c.Pause()
+}
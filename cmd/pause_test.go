@@ -0,0 +1,48 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yohamta/dagu/internal/config"
+	"github.com/yohamta/dagu/internal/controller"
+	"github.com/yohamta/dagu/internal/database"
+	"github.com/yohamta/dagu/internal/scheduler"
+)
+
+func Test_pauseCommand(t *testing.T) {
+	c := testConfig("cmd_pause.yaml")
+	test := appTest{
+		args: []string{"", "start", c}, errored: true,
+	}
+
+	app := makeApp()
+	pauser := makeApp()
+
+	go func() {
+		time.Sleep(time.Millisecond * 100)
+		runAppTestOutput(pauser, appTest{
+			args: []string{"", "pause", test.args[2]}, errored: false,
+			output: []string{"Pausing..."},
+		}, t)
+
+		// the first step finishes but the second one does not start
+		time.Sleep(time.Millisecond * 1500)
+		ctrl := controller.New(&config.Config{ConfigPath: c})
+		s, err := ctrl.GetStatus()
+		require.NoError(t, err)
+		assert.Equal(t, scheduler.SchedulerStatus_Paused, s.Status)
+		assert.Equal(t, scheduler.NodeStatusSuccess, s.Nodes[0].Status)
+		assert.Equal(t, scheduler.NodeStatusNone, s.Nodes[1].Status)
+		require.NoError(t, ctrl.Stop())
+	}()
+
+	runAppTest(app, test, t)
+
+	db := database.New(database.DefaultConfig())
+	s := db.ReadStatusHist(c, 1)
+	require.Equal(t, 1, len(s))
+	assert.Equal(t, scheduler.SchedulerStatus_Cancel, s[0].Status.Status)
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"log"
+
+	"github.com/urfave/cli/v2"
+	"github.com/yohamta/dagu/internal/config"
+	"github.com/yohamta/dagu/internal/controller"
+	"github.com/yohamta/dagu/internal/utils"
+)
+
+func newResumeCommand() *cli.Command {
+	cl := &config.Loader{
+		HomeDir: utils.MustGetUserHomeDir(),
+	}
+	return &cli.Command{
+		Name:  "resume",
+		Usage: "dagu resume <config>",
+		Action: func(c *cli.Context) error {
+			configFilePath := c.Args().Get(0)
+			cfg, err := cl.Load(configFilePath, "")
+			if err != nil {
+				return err
+			}
+			return resume(cfg)
+		},
+	}
+}
+
+func resume(cfg *config.Config) error {
+	c := controller.New(cfg)
+	log.Printf("Resuming...")
+	return c.Resume()
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yohamta/dagu/internal/config"
+	"github.com/yohamta/dagu/internal/controller"
+	"github.com/yohamta/dagu/internal/database"
+	"github.com/yohamta/dagu/internal/scheduler"
+)
+
+func Test_resumeCommand(t *testing.T) {
+	c := testConfig("cmd_pause.yaml")
+	test := appTest{
+		args: []string{"", "start", c}, errored: false,
+	}
+
+	app := makeApp()
+	resumer := makeApp()
+
+	go func() {
+		time.Sleep(time.Millisecond * 100)
+		ctrl := controller.New(&config.Config{ConfigPath: c})
+		require.NoError(t, ctrl.Pause())
+
+		time.Sleep(time.Millisecond * 1500)
+		runAppTestOutput(resumer, appTest{
+			args: []string{"", "resume", test.args[2]}, errored: false,
+			output: []string{"Resuming..."},
+		}, t)
+	}()
+
+	runAppTest(app, test, t)
+
+	db := database.New(database.DefaultConfig())
+	s := db.ReadStatusHist(c, 1)
+	require.Equal(t, 1, len(s))
+	assert.Equal(t, scheduler.SchedulerStatus_Success, s[0].Status.Status)
+	assert.Equal(t, scheduler.NodeStatusSuccess, s[0].Status.Nodes[1].Status)
+}
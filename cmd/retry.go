@@ -1,6 +1,7 @@
 package main
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
 
@@ -63,6 +64,8 @@ func retry(f, requestId string) error {
 	})
 
 	err = a.Run()
-	utils.LogIgnoreErr("retry", err)
-	return nil
+	if err != nil {
+		err = fmt.Errorf("retry failed: %w", err)
+	}
+	return runResult(a, err)
 }
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/yohamta/dagu/internal/admin"
+	"github.com/yohamta/dagu/internal/runner"
+	"github.com/yohamta/dagu/internal/utils"
+)
+
+func Test_schedulerCommand(t *testing.T) {
+	dir := utils.MustTempDir("dagu_test_scheduler")
+	defer os.RemoveAll(dir)
+
+	r := runner.New(&admin.Config{
+		DAGs:    testsDir,
+		Command: "dagu",
+		WorkDir: dir,
+	})
+	done := make(chan struct{})
+	go func() {
+		r.Start()
+		close(done)
+	}()
+
+	time.Sleep(time.Millisecond * 100)
+	r.Stop()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		require.Fail(t, "scheduler did not stop")
+	}
+}
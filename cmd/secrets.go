@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/urfave/cli/v2"
+	"github.com/yohamta/dagu/internal/config"
+)
+
+func newSecretsCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "secrets",
+		Usage: "dagu secrets <encrypt|decrypt> <file>",
+		Subcommands: []*cli.Command{
+			{
+				Name:  "encrypt",
+				Usage: "dagu secrets encrypt <dotenv file>",
+				Action: func(c *cli.Context) error {
+					return convertSecrets(c.Args().Get(0), config.EncryptSecrets)
+				},
+			},
+			{
+				Name:  "decrypt",
+				Usage: "dagu secrets decrypt <secrets file>",
+				Action: func(c *cli.Context) error {
+					return convertSecrets(c.Args().Get(0), config.DecryptSecrets)
+				},
+			},
+		},
+	}
+}
+
+// convertSecrets converts the file with the secrets key
+// and writes the result to the standard output.
+func convertSecrets(file string, fn func(data []byte, key string) ([]byte, error)) error {
+	if file == "" {
+		return fmt.Errorf("file was not specified")
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	key, err := config.SecretsKey()
+	if err != nil {
+		return err
+	}
+	ret, err := fn(data, key)
+	if err != nil {
+		return err
+	}
+	_, err = os.Stdout.Write(ret)
+	return err
+}
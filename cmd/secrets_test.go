@@ -0,0 +1,39 @@
+package main
+
+import (
+	"os"
+	"testing"
+
+	"github.com/yohamta/dagu/internal/settings"
+)
+
+func Test_secretsCommand(t *testing.T) {
+	os.Setenv(settings.SecretsKeyEnv, "test-key")
+	defer os.Unsetenv(settings.SecretsKeyEnv)
+
+	tests := []appTest{
+		{
+			args:    []string{"", "secrets", "encrypt", testConfig("config_dotenv.env")},
+			errored: false,
+			output:  []string{"dagu-secrets:v2 scrypt "},
+		},
+		{
+			args:    []string{"", "secrets", "decrypt", testConfig("config_dotenv_secrets.enc")},
+			errored: false,
+			output:  []string{"DOTENV_PASSWORD=dotenv-password"},
+		},
+		{
+			args:    []string{"", "secrets", "decrypt", testConfig("config_dotenv.env")},
+			errored: true,
+		},
+		{
+			args:    []string{"", "secrets", "encrypt"},
+			errored: true,
+		},
+	}
+
+	for _, v := range tests {
+		app := makeApp()
+		runAppTestOutput(app, v, t)
+	}
+}
@@ -1,11 +1,19 @@
 package main
 
 import (
+	"fmt"
+	"log"
 	"os"
+	"os/exec"
+	"syscall"
 
+	"github.com/segmentio/ksuid"
 	"github.com/urfave/cli/v2"
 	"github.com/yohamta/dagu/internal/agent"
 	"github.com/yohamta/dagu/internal/config"
+	"github.com/yohamta/dagu/internal/controller"
+	"github.com/yohamta/dagu/internal/scheduler"
+	"github.com/yohamta/dagu/internal/settings"
 	"github.com/yohamta/dagu/internal/utils"
 )
 
@@ -15,7 +23,7 @@ func newStartCommand() *cli.Command {
 	}
 	return &cli.Command{
 		Name:  "start",
-		Usage: "dagu start [--params=\"<params>\"] <config>",
+		Usage: "dagu start [--params=\"<params>\"] [--req=<request-id>] [--no-wait] <config>",
 		Flags: []cli.Flag{
 			&cli.StringFlag{
 				Name:     "params",
@@ -23,6 +31,26 @@ func newStartCommand() *cli.Command {
 				Value:    "",
 				Required: false,
 			},
+			&cli.StringFlag{
+				Name:     "req",
+				Usage:    "request-id (generated if not specified)",
+				Value:    "",
+				Required: false,
+			},
+			&cli.BoolFlag{
+				Name:  "wait",
+				Usage: "wait for the DAG to finish and exit with its status",
+				Value: true,
+			},
+			&cli.BoolFlag{
+				Name:  "no-wait",
+				Usage: "start the DAG in the background and exit",
+			},
+			&cli.BoolFlag{
+				// set by the agent starting the run from the queue
+				Name:   "queued",
+				Hidden: true,
+			},
 		},
 		Action: func(c *cli.Context) error {
 			configFilePath := c.Args().Get(0)
@@ -30,15 +58,21 @@ func newStartCommand() *cli.Command {
 			if err != nil {
 				return err
 			}
-			return start(cfg)
+			if !c.Bool("wait") || c.Bool("no-wait") {
+				return startNoWait(cfg, c.String("params"), c.String("req"))
+			}
+			return start(cfg, c.String("params"), c.String("req"), c.Bool("queued"))
 		},
 	}
 }
 
-func start(cfg *config.Config) error {
+func start(cfg *config.Config, params, requestId string, queued bool) error {
 	a := &agent.Agent{Config: &agent.Config{
-		DAG: cfg,
-		Dry: false,
+		DAG:       cfg,
+		Dry:       false,
+		RequestId: requestId,
+		Params:    params,
+		Queued:    queued,
 	}}
 
 	listenSignals(func(sig os.Signal) {
@@ -46,6 +80,40 @@ func start(cfg *config.Config) error {
 	})
 
 	err := a.Run()
-	utils.LogIgnoreErr("running", err)
-	return nil
+	if err != nil {
+		// wrapped so that the cli does not exit with the step's exit status
+		err = fmt.Errorf("running failed: %w", err)
+	}
+	return runResult(a, err)
+}
+
+// startNoWait starts the DAG in a new dagu process in the background
+// and returns without waiting for it to finish.
+func startNoWait(cfg *config.Config, params, requestId string) error {
+	if cfg.OverlapPolicy == config.OverlapSkip {
+		status, err := controller.New(cfg).GetStatus()
+		if err != nil {
+			return err
+		}
+		if status.Status != scheduler.SchedulerStatus_None {
+			return &exitError{code: exitAlreadyRunning, err: agent.ErrAlreadyRunning}
+		}
+	}
+	if requestId == "" {
+		requestId = ksuid.New().String()
+	}
+	args := []string{"start", fmt.Sprintf("--req=%s", requestId)}
+	if params != "" {
+		args = append(args, fmt.Sprintf("--params=%s", params))
+	}
+	args = append(args, cfg.ConfigPath)
+	cmd := exec.Command(settings.MustGet(settings.ConfigExecutable), args...)
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Env = os.Environ()
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	log.Printf("Started %s in the background (request ID: %s, pid: %d)",
+		cfg.Name, requestId, cmd.Process.Pid)
+	return cmd.Process.Release()
 }
@@ -2,6 +2,12 @@ package main
 
 import (
 	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/yohamta/dagu/internal/config"
+	"github.com/yohamta/dagu/internal/controller"
+	"github.com/yohamta/dagu/internal/scheduler"
 )
 
 func Test_startCommand(t *testing.T) {
@@ -22,6 +28,14 @@ func Test_startCommand(t *testing.T) {
 			args: []string{"", "start", "--params=x y", testConfig("cmd_start_with_params_2.yaml")}, errored: false,
 			output: []string{"params are x and y"},
 		},
+		{
+			args: []string{"", "start", "--params=DATE=2022-01-01", testConfig("cmd_start_with_named_params.yaml")}, errored: false,
+			output: []string{"date is 2022-01-01"},
+		},
+		{
+			args: []string{"", "start", testConfig("cmd_start_with_named_params.yaml")}, errored: true,
+			output: []string{},
+		},
 	}
 
 	for _, v := range tests {
@@ -29,3 +43,83 @@ func Test_startCommand(t *testing.T) {
 		runAppTestOutput(app, v, t)
 	}
 }
+
+func Test_startExitCode(t *testing.T) {
+	for _, v := range []struct {
+		file string
+		code int
+	}{
+		{"cmd_start_multiple_steps.yaml", exitSuccess},
+		{"cmd_start_fail.yaml", exitFailure},
+		{"cmd_start_skipped.yaml", exitSkipped},
+	} {
+		err := makeApp().Run([]string{"", "start", testConfig(v.file)})
+		require.Equal(t, v.code, exitCode(err), v.file)
+	}
+
+	c := testConfig("cmd_start_sleep.yaml")
+	done := make(chan error)
+	go func() {
+		done <- makeApp().Run([]string{"", "start", c})
+	}()
+	cfg, err := (&config.Loader{}).Load(c, "")
+	require.NoError(t, err)
+	ctrl := controller.New(cfg)
+	require.Eventually(t, func() bool {
+		st, err := ctrl.GetStatus()
+		return err == nil && st.Status == scheduler.SchedulerStatus_Running
+	}, time.Second*3, time.Millisecond*50)
+
+	err = makeApp().Run([]string{"", "start", c})
+	require.Equal(t, exitAlreadyRunning, exitCode(err))
+	err = makeApp().Run([]string{"", "start", "--no-wait", c})
+	require.Equal(t, exitAlreadyRunning, exitCode(err))
+
+	require.NoError(t, ctrl.Stop())
+	require.Equal(t, exitCanceled, exitCode(<-done))
+}
+
+func Test_startNoWait(t *testing.T) {
+	c := testConfig("cmd_start_no_wait.yaml")
+	runAppTestOutput(makeApp(), appTest{
+		args: []string{"", "start", "--no-wait", c}, errored: false,
+		output: []string{"Started no wait in the background"},
+	}, t)
+
+	cfg, err := (&config.Loader{}).Load(c, "")
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		st, err := controller.New(cfg).GetLastStatus()
+		return err == nil && st.Status == scheduler.SchedulerStatus_Success
+	}, time.Second*5, time.Millisecond*100)
+}
+
+func Test_startQueued(t *testing.T) {
+	c := testConfig("cmd_start_queue.yaml")
+	done := make(chan error)
+	go func() {
+		done <- makeApp().Run([]string{"", "start", c})
+	}()
+	cfg, err := (&config.Loader{}).Load(c, "")
+	require.NoError(t, err)
+	ctrl := controller.New(cfg)
+	require.Eventually(t, func() bool {
+		st, err := ctrl.GetStatus()
+		return err == nil && st.Status == scheduler.SchedulerStatus_Running
+	}, time.Second*3, time.Millisecond*50)
+
+	runAppTestOutput(makeApp(), appTest{
+		args: []string{"", "start", "--req=queued-run", c}, errored: true,
+		output: []string{"queued queue (request ID: queued-run"},
+	}, t)
+	err = makeApp().Run([]string{"", "start", "--req=queued-run-2", c})
+	require.Equal(t, exitQueued, exitCode(err))
+	require.NoError(t, <-done)
+
+	for _, req := range []string{"queued-run", "queued-run-2"} {
+		require.Eventually(t, func() bool {
+			st, err := ctrl.GetStatusByRequestId(req)
+			return err == nil && st.Status == scheduler.SchedulerStatus_Success
+		}, time.Second*10, time.Millisecond*100)
+	}
+}
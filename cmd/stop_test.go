@@ -14,7 +14,7 @@ import (
 func Test_stopCommand(t *testing.T) {
 	c := testConfig("cmd_stop_sleep.yaml")
 	test := appTest{
-		args: []string{"", "start", c}, errored: false,
+		args: []string{"", "start", c}, errored: true,
 	}
 
 	app := makeApp()
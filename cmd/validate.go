@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/urfave/cli/v2"
+	"github.com/yohamta/dagu/internal/config"
+	"github.com/yohamta/dagu/internal/scheduler"
+	"github.com/yohamta/dagu/internal/utils"
+)
+
+func newValidateCommand() *cli.Command {
+	cl := &config.Loader{
+		HomeDir: utils.MustGetUserHomeDir(),
+	}
+	return &cli.Command{
+		Name:  "validate",
+		Usage: "dagu validate <config> [<config>...]",
+		Action: func(c *cli.Context) error {
+			if c.NArg() == 0 {
+				return fmt.Errorf("config file was not specified")
+			}
+			count := 0
+			for _, file := range c.Args().Slice() {
+				errs := validate(cl, file)
+				for _, err := range errs {
+					fmt.Println(err)
+				}
+				if len(errs) == 0 {
+					fmt.Printf("%s: ok\n", file)
+				}
+				count += len(errs)
+			}
+			if count > 0 {
+				return fmt.Errorf("%d problem(s) found", count)
+			}
+			return nil
+		},
+	}
+}
+
+// validate reports the problems found in the file. When no problem
+// is located in the file, the config is loaded and the execution
+// graph is built to check the rest in the same way as a run does.
+func validate(cl *config.Loader, file string) []error {
+	var ret []error
+	for _, err := range cl.Validate(file) {
+		ret = append(ret, err)
+	}
+	if len(ret) > 0 {
+		return ret
+	}
+	cfg, err := cl.Load(file, "")
+	if err == nil {
+		_, err = scheduler.NewExecutionGraph(cfg.Steps...)
+	}
+	if err != nil {
+		ret = append(ret, &config.ValidationError{File: file, Message: err.Error()})
+	}
+	return ret
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"testing"
+)
+
+func Test_validateCommand(t *testing.T) {
+	tests := []appTest{
+		{
+			args:    []string{"", "validate", testConfig("cmd_dry.yaml"), testConfig("cmd_status.yaml")},
+			errored: false,
+			output:  []string{"cmd_dry.yaml: ok", "cmd_status.yaml: ok"},
+		},
+		{
+			args:    []string{"", "validate", testConfig("config_err_validate.yaml")},
+			errored: true,
+			output:  []string{"config_err_validate.yaml:6: unknown key \"depend\""},
+		},
+		{
+			args:    []string{"", "validate", testConfig("config_err_no_name.yaml")},
+			errored: true,
+			output:  []string{"config_err_no_name.yaml: DAG name must be specified"},
+		},
+		{
+			args:    []string{"", "validate"},
+			errored: true,
+		},
+	}
+
+	for _, v := range tests {
+		app := makeApp()
+		runAppTestOutput(app, v, t)
+	}
+}
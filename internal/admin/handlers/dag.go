@@ -18,6 +18,7 @@ import (
 	"github.com/yohamta/dagu/internal/database"
 	"github.com/yohamta/dagu/internal/models"
 	"github.com/yohamta/dagu/internal/scheduler"
+	"github.com/yohamta/dagu/internal/utils"
 	"golang.org/x/text/encoding"
 	"golang.org/x/text/encoding/japanese"
 	"golang.org/x/text/transform"
@@ -40,11 +41,13 @@ type dagResponse struct {
 	Tab        dagTabType
 	Graph      string
 	Definition string
-	LogData    *Log
-	LogUrl     string
-	Group      string
-	StepLog    *stepLog
-	ScLog      *schedulerLog
+	// ResolvedDefinition is the definition with extends and include resolved.
+	ResolvedDefinition string
+	LogData            *Log
+	LogUrl             string
+	Group              string
+	StepLog            *stepLog
+	ScLog              *schedulerLog
 }
 
 type schedulerLog struct {
@@ -70,10 +73,11 @@ const (
 )
 
 type dagParameter struct {
-	Tab   dagTabType
-	Group string
-	File  string
-	Step  string
+	Tab       dagTabType
+	Group     string
+	File      string
+	Step      string
+	RequestId string
 }
 
 func newDAGResponse(cfg string, dag *controller.DAG, tab dagTabType,
@@ -114,12 +118,22 @@ func HandleGetDAG(hc *DAGHandlerConfig) http.HandlerFunc {
 
 		switch params.Tab {
 		case DagTabtypeStatus:
+			if params.RequestId != "" {
+				dag.Status, err = c.GetStatusByRequestId(params.RequestId)
+				if err != nil {
+					encodeError(w, err)
+					return
+				}
+			}
 			data.Graph = models.StepGraph(dag.Status.Nodes, params.Tab != DagTabtypeConfig)
 
 		case DagTabtypeConfig:
 			steps := models.FromSteps(dag.Config.Steps)
 			data.Graph = models.StepGraph(steps, params.Tab != DagTabtypeConfig)
-			data.Definition, _ = config.ReadConfig(path.Join(hc.DAGsDir, params.Group, cfg))
+			file := path.Join(hc.DAGsDir, params.Group, cfg)
+			data.Definition, _ = config.ReadConfig(file)
+			cl := &config.Loader{HomeDir: utils.MustGetUserHomeDir()}
+			data.ResolvedDefinition, _ = cl.ReadResolved(file)
 
 		case DagTabtypeHistory:
 			logs := controller.New(dag.Config).GetStatusHist(30)
@@ -171,6 +185,7 @@ func HandlePostDAGAction(hc *PostDAGHandlerConfig) http.HandlerFunc {
 		group := r.FormValue("group")
 		reqId := r.FormValue("request-id")
 		step := r.FormValue("step")
+		params := r.FormValue("params")
 
 		cfg, err := getPathParameter(r)
 		if err != nil {
@@ -188,12 +203,17 @@ func HandlePostDAGAction(hc *PostDAGHandlerConfig) http.HandlerFunc {
 
 		switch action {
 		case "start":
-			if dag.Status.Status == scheduler.SchedulerStatus_Running {
+			if dag.Status.Status.IsRunning() {
 				w.WriteHeader(http.StatusBadRequest)
 				w.Write([]byte("DAG is already running."))
 				return
 			}
-			err = c.Start(hc.Bin, hc.WkDir, "")
+			if err := validateParams(file, params); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(err.Error()))
+				return
+			}
+			err = c.Start(hc.Bin, hc.WkDir, params)
 			if err != nil {
 				w.WriteHeader(http.StatusInternalServerError)
 				w.Write([]byte(err.Error()))
@@ -201,7 +221,7 @@ func HandlePostDAGAction(hc *PostDAGHandlerConfig) http.HandlerFunc {
 			}
 
 		case "stop":
-			if dag.Status.Status != scheduler.SchedulerStatus_Running {
+			if !dag.Status.Status.IsRunning() {
 				w.WriteHeader(http.StatusBadRequest)
 				w.Write([]byte("DAG is not running."))
 				return
@@ -213,6 +233,23 @@ func HandlePostDAGAction(hc *PostDAGHandlerConfig) http.HandlerFunc {
 				return
 			}
 
+		case "pause", "resume":
+			if !dag.Status.Status.IsRunning() {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte("DAG is not running."))
+				return
+			}
+			if action == "pause" {
+				err = c.Pause()
+			} else {
+				err = c.Resume()
+			}
+			if err != nil {
+				w.WriteHeader(http.StatusNotFound)
+				w.Write([]byte(err.Error()))
+				return
+			}
+
 		case "retry":
 			if reqId == "" {
 				w.WriteHeader(http.StatusBadRequest)
@@ -227,7 +264,7 @@ func HandlePostDAGAction(hc *PostDAGHandlerConfig) http.HandlerFunc {
 			}
 
 		case "mark-success":
-			if dag.Status.Status == scheduler.SchedulerStatus_Running {
+			if dag.Status.Status.IsRunning() {
 				w.WriteHeader(http.StatusBadRequest)
 				w.Write([]byte("DAG is running."))
 				return
@@ -251,7 +288,7 @@ func HandlePostDAGAction(hc *PostDAGHandlerConfig) http.HandlerFunc {
 			}
 
 		case "mark-failed":
-			if dag.Status.Status == scheduler.SchedulerStatus_Running {
+			if dag.Status.Status.IsRunning() {
 				w.WriteHeader(http.StatusBadRequest)
 				w.Write([]byte("DAG is running."))
 				return
@@ -283,6 +320,17 @@ func HandlePostDAGAction(hc *PostDAGHandlerConfig) http.HandlerFunc {
 	}
 }
 
+// validateParams loads the DAG with the parameters to check
+// them before starting the DAG.
+func validateParams(file, params string) error {
+	cl := &config.Loader{HomeDir: utils.MustGetUserHomeDir()}
+	cfg, err := cl.Load(file, params)
+	if err != nil {
+		return err
+	}
+	return cfg.ValidateParams()
+}
+
 func updateStatus(c controller.Controller, reqId, step string, to scheduler.NodeStatus) error {
 	status, err := c.GetStatusByRequestId(reqId)
 	if err != nil {
@@ -476,5 +524,8 @@ func getDAGParameter(r *http.Request) *dagParameter {
 	if step, ok := r.URL.Query()["step"]; ok {
 		p.Step = step[0]
 	}
+	if req, ok := r.URL.Query()["req"]; ok {
+		p.RequestId = req[0]
+	}
 	return p
 }
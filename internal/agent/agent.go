@@ -7,9 +7,11 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"os/exec"
 	"path"
 	"path/filepath"
 	"regexp"
+	"sync/atomic"
 	"syscall"
 	"time"
 
@@ -19,8 +21,11 @@ import (
 	"github.com/yohamta/dagu/internal/database"
 	"github.com/yohamta/dagu/internal/mail"
 	"github.com/yohamta/dagu/internal/models"
+	"github.com/yohamta/dagu/internal/pool"
+	"github.com/yohamta/dagu/internal/queue"
 	"github.com/yohamta/dagu/internal/reporter"
 	"github.com/yohamta/dagu/internal/scheduler"
+	"github.com/yohamta/dagu/internal/settings"
 	"github.com/yohamta/dagu/internal/sock"
 	"github.com/yohamta/dagu/internal/utils"
 )
@@ -37,11 +42,22 @@ type Agent struct {
 	dbWriter     *database.Writer
 	socketServer *sock.Server
 	requestId    string
+	startToken   string
+	stopping     int32
+	// unlockQueue releases the lock of the queue of the DAG
+	// held while the run is starting.
+	unlockQueue func()
 }
 
 type Config struct {
-	DAG *config.Config
-	Dry bool
+	DAG       *config.Config
+	Dry       bool
+	RequestId string
+	// Params are the parameters the DAG was started with,
+	// which are saved with the run when it is queued.
+	Params string
+	// Queued is true when the run is started from the queue.
+	Queued bool
 }
 
 type RetryConfig struct {
@@ -49,6 +65,9 @@ type RetryConfig struct {
 }
 
 func (a *Agent) Run() error {
+	if err := a.DAG.ValidateParams(); err != nil {
+		return err
+	}
 	a.init()
 	if err := a.setupGraph(); err != nil {
 		return err
@@ -59,9 +78,9 @@ func (a *Agent) Run() error {
 	if a.Dry {
 		return a.dryRun()
 	}
+	defer a.releaseQueue()
 	setup := []func() error{
-		a.checkIsRunning,
-		a.setupRequestId,
+		a.checkOverlap,
 		a.setupDatabase,
 		a.setupSocketServer,
 	}
@@ -71,10 +90,19 @@ func (a *Agent) Run() error {
 			return err
 		}
 	}
-	return a.run()
+	err := a.run()
+	if a.DAG.OverlapPolicy == config.OverlapQueue {
+		a.startNext()
+	}
+	return err
 }
 
 func (a *Agent) Status() *models.Status {
+	if a.graph == nil {
+		// the DAG has not been set up to run
+		return models.NewStatus(a.DAG, nil,
+			scheduler.SchedulerStatus_None, int(models.PidNotRunning), nil, nil)
+	}
 	status := models.NewStatus(
 		a.DAG,
 		a.graph.Nodes(),
@@ -85,6 +113,7 @@ func (a *Agent) Status() *models.Status {
 	)
 	status.RequestId = a.requestId
 	status.Log = a.logFilename
+	status.StartToken = a.startToken
 	if node := a.scheduler.HanderNode(constants.OnExit); node != nil {
 		status.OnExit = models.FromNode(node)
 	}
@@ -100,12 +129,19 @@ func (a *Agent) Status() *models.Status {
 	return status
 }
 
-// Signal sends the signal to the processes running
-// if processes do not terminate after MaxCleanUp time,
-// will send signal -1 to the processes.
+// Signal stops the running steps gracefully. It sends the signal, or
+// the signalOnStop of each step, to the process groups of the steps and
+// waits for them to exit. The steps still running after MaxCleanUpTime
+// are killed with SIGKILL. A signal received while stopping kills the
+// steps immediately.
 func (a *Agent) Signal(sig os.Signal) {
+	if !atomic.CompareAndSwapInt32(&a.stopping, 0, 1) {
+		log.Printf("Received %s while stopping.", sig)
+		a.Kill()
+		return
+	}
 	log.Printf("Sending %s signal to running child processes.", sig)
-	done := make(chan bool)
+	done := make(chan bool, 1)
 	go func() {
 		a.scheduler.Signal(a.graph, sig, done)
 	}()
@@ -113,14 +149,17 @@ func (a *Agent) Signal(sig os.Signal) {
 	case <-done:
 		log.Printf("All child processes have been terminated.")
 	case <-time.After(a.DAG.MaxCleanUpTime):
-		log.Printf("Time reached to max cleanup time")
-		a.Cancel()
-	default:
-		log.Printf("Waiting for child processes to exit...")
-		time.Sleep(time.Second * 1)
+		log.Printf("Child processes did not exit within %s.", a.DAG.MaxCleanUpTime)
+		a.Kill()
 	}
 }
 
+// Kill kills the running steps with SIGKILL.
+func (a *Agent) Kill() {
+	log.Printf("Killing running child processes.")
+	a.scheduler.Kill(a.graph)
+}
+
 // Cancel sends signal -1 to all child processes.
 // then it waits another 60 seconds before therminating the
 // parent process.
@@ -129,17 +168,46 @@ func (a *Agent) Cancel() {
 	a.scheduler.Cancel(a.graph)
 }
 
+// pools returns the pools of the global config. The lock files of
+// their slots are under the data directory, shared by the agents.
+func (a *Agent) pools() map[string]*pool.Pool {
+	dir := path.Join(settings.MustGet(settings.ConfigDataDir), "pools")
+	ret := map[string]*pool.Pool{}
+	for _, p := range a.DAG.Pools {
+		ret[p.Name] = pool.New(dir, p.Name, p.Size)
+	}
+	return ret
+}
+
 func (a *Agent) init() {
+	a.startToken = utils.ProcessStartToken(os.Getpid())
+	a.requestId = a.Config.RequestId
+	if a.requestId == "" {
+		a.requestId = ksuid.New().String()
+	}
+	// the request ID tells the logs of the runs started
+	// in the same second apart
+	a.logFilename = filepath.Join(
+		a.DAG.LogDir, fmt.Sprintf("%s.%s.%s.log",
+			utils.ValidFilename(a.DAG.Name, "_"),
+			time.Now().Format("20060102.15:04:05"),
+			utils.ValidFilename(a.requestId, "_"),
+		))
 	a.scheduler = scheduler.New(
 		&scheduler.Config{
-			LogDir:        path.Join(a.DAG.LogDir, utils.ValidFilename(a.DAG.Name, "_")),
-			MaxActiveRuns: a.DAG.MaxActiveRuns,
-			Delay:         a.DAG.Delay,
-			Dry:           a.Dry,
-			OnExit:        a.DAG.HandlerOn.Exit,
-			OnSuccess:     a.DAG.HandlerOn.Success,
-			OnFailure:     a.DAG.HandlerOn.Failure,
-			OnCancel:      a.DAG.HandlerOn.Cancel,
+			Name:             a.DAG.Name,
+			RequestId:        a.requestId,
+			SchedulerLogFile: a.logFilename,
+			LogDir:           path.Join(a.DAG.LogDir, utils.ValidFilename(a.DAG.Name, "_")),
+			MaxActiveRuns:    a.DAG.MaxActiveRuns,
+			Delay:            a.DAG.Delay,
+			Dry:              a.Dry,
+			OnExit:           a.DAG.HandlerOn.Exit,
+			OnSuccess:        a.DAG.HandlerOn.Success,
+			OnFailure:        a.DAG.HandlerOn.Failure,
+			OnCancel:         a.DAG.HandlerOn.Cancel,
+			Timeout:          a.DAG.Timeout,
+			Pools:            a.pools(),
 		})
 	a.reporter = &reporter.Reporter{
 		Config: &reporter.Config{
@@ -149,11 +217,6 @@ func (a *Agent) init() {
 					Port: a.DAG.Smtp.Port,
 				}),
 		}}
-	a.logFilename = filepath.Join(
-		a.DAG.LogDir, fmt.Sprintf("%s.%s.log",
-			utils.ValidFilename(a.DAG.Name, "_"),
-			time.Now().Format("20060102.15:04:05"),
-		))
 }
 
 func (a *Agent) setupGraph() (err error) {
@@ -168,27 +231,25 @@ func (a *Agent) setupGraph() (err error) {
 func (a *Agent) setupRetry() (err error) {
 	var nodes []*scheduler.Node
 	for _, n := range a.RetryConfig.Status.Nodes {
-		nodes = append(nodes, n.ToNode())
+		node := n.ToNode()
+		// secrets are not saved in the status
+		node.Secrets = a.DAG.SecretVariables()
+		nodes = append(nodes, node)
 	}
 	a.graph, err = scheduler.RetryExecutionGraph(nodes...)
 	return
 }
 
-func (a *Agent) setupRequestId() error {
-	a.requestId = ksuid.New().String()
-	return nil
-}
-
 func (a *Agent) setupDatabase() (err error) {
 	a.database = database.New(database.DefaultConfig())
-	a.dbWriter, a.dbFile, err = a.database.NewWriter(a.DAG.ConfigPath, time.Now())
+	a.dbWriter, a.dbFile, err = a.database.NewWriter(a.DAG.ConfigPath, time.Now(), a.requestId)
 	return
 }
 
 func (a *Agent) setupSocketServer() (err error) {
 	a.socketServer, err = sock.NewServer(
 		&sock.Config{
-			Addr:        sock.GetSockAddr(a.DAG.ConfigPath),
+			Addr:        a.sockAddr(),
 			HandlerFunc: a.handleHTTP,
 		})
 	return
@@ -197,9 +258,9 @@ func (a *Agent) setupSocketServer() (err error) {
 func (a *Agent) checkPreconditions() error {
 	if len(a.DAG.Preconditions) > 0 {
 		log.Printf("checking pre conditions for \"%s\"", a.DAG.Name)
-		if err := config.EvalConditions(a.DAG.Preconditions); err != nil {
+		if err := config.EvalConditions(a.DAG.Preconditions, a.DAG.Env); err != nil {
 			a.scheduler.Cancel(a.graph)
-			return err
+			return fmt.Errorf("%w: %s", ErrPreconditionsNotMet, err)
 		}
 	}
 	return nil
@@ -242,11 +303,14 @@ func (a *Agent) run() error {
 	if err := <-listen; err != nil {
 		return fmt.Errorf("failed to start the socket server")
 	}
+	// the other agents see this run as running now
+	a.releaseQueue()
 
 	done := make(chan *scheduler.Node)
-	defer close(done)
+	reported := make(chan struct{})
 
 	go func() {
+		defer close(reported)
 		for node := range done {
 			status := a.Status()
 			a.dbWriter.Write(status)
@@ -255,6 +319,10 @@ func (a *Agent) run() error {
 	}()
 
 	lastErr := a.scheduler.Schedule(a.graph, done)
+	// wait for the last step to be reported so that its status is
+	// not written after the final one.
+	close(done)
+	<-reported
 	status := a.Status()
 
 	log.Println("schedule finished.")
@@ -271,8 +339,9 @@ func (a *Agent) run() error {
 
 func (a *Agent) dryRun() error {
 	done := make(chan *scheduler.Node)
-	defer close(done)
+	reported := make(chan struct{})
 	go func() {
+		defer close(reported)
 		for node := range done {
 			status := a.Status()
 			a.reporter.ReportStep(a.DAG, status, node)
@@ -282,6 +351,8 @@ func (a *Agent) dryRun() error {
 	log.Printf("***** Starting DRY-RUN *****")
 
 	lastErr := a.scheduler.Schedule(a.graph, done)
+	close(done)
+	<-reported
 	status := a.Status()
 	a.reporter.ReportSummary(status, lastErr)
 
@@ -296,15 +367,138 @@ func (a *Agent) checkIsRunning() error {
 		return err
 	}
 	if status.Status != scheduler.SchedulerStatus_None {
-		return fmt.Errorf("the DAG is already running. socket=%s",
+		return fmt.Errorf("%w. socket=%s", ErrAlreadyRunning,
 			sock.GetSockAddr(a.DAG.ConfigPath))
 	}
 	return nil
 }
 
+// sockAddr returns the address of the socket of the agent. The runs
+// of a DAG running in parallel have their own sockets.
+func (a *Agent) sockAddr() string {
+	if a.DAG.OverlapPolicy == config.OverlapParallel {
+		return sock.GetInstanceSockAddr(a.DAG.ConfigPath, a.requestId)
+	}
+	return sock.GetSockAddr(a.DAG.ConfigPath)
+}
+
+// checkOverlap checks if the DAG can run now by its overlapPolicy.
+// Retries are not queued and fail while the DAG is running.
+func (a *Agent) checkOverlap() error {
+	switch a.DAG.OverlapPolicy {
+	case config.OverlapParallel:
+		return nil
+	case config.OverlapQueue:
+		if a.RetryConfig == nil {
+			return a.checkQueue()
+		}
+	}
+	return a.checkIsRunning()
+}
+
+func (a *Agent) queue() *queue.Queue {
+	return queue.New(
+		path.Join(settings.MustGet(settings.ConfigDataDir), "queue"),
+		a.DAG.ConfigPath)
+}
+
+// checkQueue queues the run if the DAG is running or other runs are
+// waiting in the queue. Otherwise, it keeps the queue locked until the
+// socket server starts, so that the runs started meanwhile are queued.
+func (a *Agent) checkQueue() error {
+	q := a.queue()
+	unlock, err := q.Lock()
+	if err != nil {
+		return err
+	}
+	a.unlockQueue = unlock
+	items, err := q.Items()
+	if err != nil {
+		return err
+	}
+	running := a.isRunning()
+	if a.Queued {
+		if running {
+			// the running one starts it when it ends
+			return ErrQueued
+		}
+		removed, err := q.Remove(a.requestId)
+		if err != nil {
+			return err
+		}
+		if !removed {
+			return ErrNotQueued
+		}
+		return nil
+	}
+	if !running && len(items) == 0 {
+		return nil
+	}
+	item := &queue.Item{RequestId: a.requestId, Params: a.Params}
+	if err := q.Push(item); err != nil {
+		return err
+	}
+	log.Printf("queued %s (request ID: %s, %d waiting ahead)",
+		a.DAG.Name, a.requestId, len(items))
+	if !running {
+		// the agent that should have started the queue has gone
+		a.startQueued(items[0])
+	}
+	return ErrQueued
+}
+
+// isRunning returns true if an agent of the DAG is listening on the
+// socket, even if it has not started the steps yet.
+func (a *Agent) isRunning() bool {
+	client := sock.Client{Addr: sock.GetSockAddr(a.DAG.ConfigPath)}
+	_, err := client.Request("GET", "/status")
+	return err == nil || errors.Is(err, sock.ErrTimeout)
+}
+
+func (a *Agent) releaseQueue() {
+	if a.unlockQueue != nil {
+		a.unlockQueue()
+		a.unlockQueue = nil
+	}
+}
+
+// startNext starts the first run in the queue after this run ends.
+func (a *Agent) startNext() {
+	items, err := a.queue().Items()
+	if err != nil {
+		utils.LogIgnoreErr("read queue", err)
+		return
+	}
+	if len(items) > 0 {
+		a.startQueued(items[0])
+	}
+}
+
+// startQueued starts the run from the queue in a new dagu process.
+// The process removes the run from the queue when it starts.
+func (a *Agent) startQueued(item *queue.Item) {
+	args := []string{"start", "--queued", fmt.Sprintf("--req=%s", item.RequestId)}
+	if item.Params != "" {
+		args = append(args, fmt.Sprintf("--params=%s", item.Params))
+	}
+	args = append(args, a.DAG.ConfigPath)
+	cmd := exec.Command(settings.MustGet(settings.ConfigExecutable), args...)
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Env = os.Environ()
+	if err := cmd.Start(); err != nil {
+		utils.LogIgnoreErr("start queued run", err)
+		return
+	}
+	log.Printf("started the queued run of %s (request ID: %s, pid: %d)",
+		a.DAG.Name, item.RequestId, cmd.Process.Pid)
+	utils.LogIgnoreErr("start queued run", cmd.Process.Release())
+}
+
 var (
 	statusRe = regexp.MustCompile(`^/status[/]?$`)
 	stopRe   = regexp.MustCompile(`^/stop[/]?$`)
+	pauseRe  = regexp.MustCompile(`^/pause[/]?$`)
+	resumeRe = regexp.MustCompile(`^/resume[/]?$`)
 )
 
 func (a *Agent) handleHTTP(w http.ResponseWriter, r *http.Request) {
@@ -322,14 +516,46 @@ func (a *Agent) handleHTTP(w http.ResponseWriter, r *http.Request) {
 	case r.Method == http.MethodPost && stopRe.MatchString(r.URL.Path):
 		w.WriteHeader(http.StatusOK)
 		w.Write([]byte("OK"))
-		a.Signal(syscall.SIGTERM)
+		go a.Signal(syscall.SIGTERM)
+	case r.Method == http.MethodPost && pauseRe.MatchString(r.URL.Path):
+		a.scheduler.Pause()
+		a.writeStatus()
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("OK"))
+	case r.Method == http.MethodPost && resumeRe.MatchString(r.URL.Path):
+		a.scheduler.Resume()
+		a.writeStatus()
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("OK"))
 	default:
 		encodeError(w, ErrNotFound)
 	}
 }
 
+// writeStatus writes the current status to the status file so that
+// the change is seen without the socket, e.g. in the history.
+func (a *Agent) writeStatus() {
+	if a.dbWriter != nil {
+		utils.LogIgnoreErr("writing status", a.dbWriter.Write(a.Status()))
+	}
+}
+
 var ErrNotFound = errors.New("not found")
 
+var (
+	// ErrAlreadyRunning is returned when the DAG is already running.
+	ErrAlreadyRunning = errors.New("the DAG is already running")
+	// ErrPreconditionsNotMet is returned when the DAG is skipped
+	// because its preconditions are not met.
+	ErrPreconditionsNotMet = errors.New("the preconditions were not met")
+	// ErrQueued is returned when the run is queued to start
+	// when the running one ends.
+	ErrQueued = errors.New("the run was queued")
+	// ErrNotQueued is returned when the run to start from the
+	// queue has been started by another process.
+	ErrNotQueued = errors.New("the run is not in the queue")
+)
+
 func encodeError(w http.ResponseWriter, err error) {
 	switch err {
 	case ErrNotFound:
@@ -5,6 +5,7 @@ import (
 	"net/url"
 	"os"
 	"path"
+	"strings"
 	"syscall"
 	"testing"
 	"time"
@@ -13,6 +14,7 @@ import (
 	"github.com/stretchr/testify/require"
 	"github.com/yohamta/dagu/internal/config"
 	"github.com/yohamta/dagu/internal/controller"
+	"github.com/yohamta/dagu/internal/database"
 	"github.com/yohamta/dagu/internal/models"
 	"github.com/yohamta/dagu/internal/scheduler"
 	"github.com/yohamta/dagu/internal/settings"
@@ -23,6 +25,7 @@ var testsDir = path.Join(utils.MustGetwd(), "../../tests/testdata")
 
 func TestMain(m *testing.M) {
 	tempDir := utils.MustTempDir("agent_test")
+	os.Setenv(settings.ConfigExecutable, path.Join(utils.MustGetwd(), "../../bin/dagu"))
 	settings.InitTest(tempDir)
 	code := m.Run()
 	os.RemoveAll(tempDir)
@@ -61,6 +64,95 @@ func TestCheckRunning(t *testing.T) {
 	_, err = testDAG(t, dag)
 	require.Error(t, err)
 	require.Contains(t, err.Error(), "is already running")
+	require.ErrorIs(t, err, ErrAlreadyRunning)
+}
+
+func TestOverlapParallel(t *testing.T) {
+	a1, dag := testDAGAsync(t, testConfig("agent_overlap_parallel.yaml"))
+	require.Eventually(t, func() bool {
+		return a1.Status().Status == scheduler.SchedulerStatus_Running
+	}, time.Second*3, time.Millisecond*50)
+
+	status, err := controller.New(dag.Config).GetStatus()
+	require.NoError(t, err)
+	require.Equal(t, scheduler.SchedulerStatus_Running, status.Status)
+
+	a2 := &Agent{Config: &Config{DAG: dag.Config}}
+	require.NoError(t, a2.Run())
+
+	require.Eventually(t, func() bool {
+		return a1.Status().Status == scheduler.SchedulerStatus_Success
+	}, time.Second*3, time.Millisecond*50)
+
+	// the runs have their own status files
+	for _, a := range []*Agent{a1, a2} {
+		status, err := controller.New(dag.Config).GetStatusByRequestId(a.requestId)
+		require.NoError(t, err)
+		require.Equal(t, scheduler.SchedulerStatus_Success, status.Status)
+	}
+}
+
+func TestOverlapParallelLogs(t *testing.T) {
+	dag, err := controller.FromConfig(testConfig("agent_overlap_parallel_logs.yaml"))
+	require.NoError(t, err)
+
+	// the runs are started in the same second
+	agents := []*Agent{
+		{Config: &Config{DAG: dag.Config}},
+		{Config: &Config{DAG: dag.Config}},
+	}
+	errs := make(chan error, len(agents))
+	for _, a := range agents {
+		go func(a *Agent) {
+			errs <- a.Run()
+		}(a)
+	}
+	for range agents {
+		require.NoError(t, <-errs)
+	}
+
+	// the runs have their own agent and step logs
+	logs := map[string]bool{}
+	for _, a := range agents {
+		status, err := controller.New(dag.Config).GetStatusByRequestId(a.requestId)
+		require.NoError(t, err)
+		require.Equal(t, scheduler.SchedulerStatus_Success, status.Status)
+		logs[status.Log] = true
+		logs[status.Nodes[0].Log] = true
+
+		b, err := os.ReadFile(status.Nodes[0].Log)
+		require.NoError(t, err)
+		require.Equal(t, a.requestId, strings.TrimSpace(string(b)))
+	}
+	require.Len(t, logs, 4)
+}
+
+func TestOverlapQueue(t *testing.T) {
+	a1, dag := testDAGAsync(t, testConfig("agent_overlap_queue.yaml"))
+	require.Eventually(t, func() bool {
+		return a1.Status().Status == scheduler.SchedulerStatus_Running
+	}, time.Second*3, time.Millisecond*50)
+
+	a2 := &Agent{Config: &Config{DAG: dag.Config, Params: "B"}}
+	require.ErrorIs(t, a2.Run(), ErrQueued)
+
+	items, err := a2.queue().Items()
+	require.NoError(t, err)
+	require.Len(t, items, 1)
+	require.Equal(t, a2.requestId, items[0].RequestId)
+	require.Equal(t, "B", items[0].Params)
+
+	// the queued run starts when the running one ends
+	var status *models.Status
+	require.Eventually(t, func() bool {
+		status, err = controller.New(dag.Config).GetStatusByRequestId(a2.requestId)
+		return err == nil && status.Status == scheduler.SchedulerStatus_Success
+	}, time.Second*10, time.Millisecond*100)
+	require.Equal(t, "B", status.Params)
+
+	items, err = a2.queue().Items()
+	require.NoError(t, err)
+	require.Len(t, items, 0)
 }
 
 func TestDryRun(t *testing.T) {
@@ -95,6 +187,26 @@ func TestCancelDAG(t *testing.T) {
 	}
 }
 
+func TestStopGracePeriod(t *testing.T) {
+	a, dag := testDAGAsync(t, testConfig("agent_stop_grace.yaml"))
+	time.Sleep(time.Millisecond * 300)
+
+	start := time.Now()
+	a.Signal(syscall.SIGTERM)
+	require.Less(t, time.Since(start), time.Second*3)
+	time.Sleep(time.Millisecond * 300)
+
+	status, err := controller.New(dag.Config).GetLastStatus()
+	require.NoError(t, err)
+	assert.Equal(t, scheduler.SchedulerStatus_Cancel, status.Status)
+
+	// the first step ignores SIGTERM and is killed after the grace period,
+	// and the second one stops with its signalOnStop
+	assert.True(t, status.Nodes[0].ForceKilled)
+	assert.Contains(t, status.Nodes[0].Error, "SIGKILL")
+	assert.False(t, status.Nodes[1].ForceKilled)
+}
+
 func TestPreConditionInvalid(t *testing.T) {
 	dag, err := controller.FromConfig(testConfig("agent_multiple_steps.yaml"))
 	require.NoError(t, err)
@@ -107,7 +219,7 @@ func TestPreConditionInvalid(t *testing.T) {
 	}
 
 	status, err := testDAG(t, dag)
-	require.Error(t, err)
+	require.ErrorIs(t, err, ErrPreconditionsNotMet)
 
 	assert.Equal(t, scheduler.SchedulerStatus_Cancel, status.Status)
 	for _, s := range status.Nodes {
@@ -134,6 +246,71 @@ func TestPreConditionValid(t *testing.T) {
 	}
 }
 
+func TestRunWithNamedParams(t *testing.T) {
+	file := testConfig("agent_named_params.yaml")
+	dag, err := controller.FromConfig(file)
+	require.NoError(t, err)
+
+	// DATE is required
+	a := &Agent{Config: &Config{DAG: dag.Config}}
+	err = a.Run()
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "DATE")
+
+	cl := &config.Loader{HomeDir: utils.MustGetUserHomeDir()}
+	cfg, err := cl.Load(file, "DATE=2022-01-01 MODE=diff")
+	require.NoError(t, err)
+
+	status, err := testDAG(t, &controller.DAG{Config: cfg})
+	require.NoError(t, err)
+	require.Equal(t, scheduler.SchedulerStatus_Success, status.Status)
+	require.Equal(t, "DATE=2022-01-01 MODE=diff", status.Params)
+	_, ok := os.LookupEnv("DATE")
+	require.False(t, ok)
+}
+
+func TestSecrets(t *testing.T) {
+	os.Setenv("AGENT_SECRET_PASSWORD", "agent-secret-password")
+	defer os.Unsetenv("AGENT_SECRET_PASSWORD")
+	dag, err := controller.FromConfig(testConfig("agent_secrets.yaml"))
+	require.NoError(t, err)
+	status, err := testDAG(t, dag)
+	require.NoError(t, err)
+	require.Equal(t, scheduler.SchedulerStatus_Success, status.Status)
+
+	// the output is redacted in the status but not for the next step
+	require.Equal(t, "token=***", status.Nodes[0].OutputValue)
+	b, err := os.ReadFile(status.Nodes[0].Log)
+	require.NoError(t, err)
+	require.Equal(t, "token=***\n", string(b))
+
+	// the secret is not saved in the status
+	last, err := controller.New(dag.Config).GetLastStatus()
+	require.NoError(t, err)
+	js, err := last.ToJson()
+	require.NoError(t, err)
+	require.NotContains(t, string(js), "agent-secret-token")
+	require.NotContains(t, string(js), "agent-secret-password")
+
+	// nor in the log of the agent
+	b, err = os.ReadFile(status.Log)
+	require.NoError(t, err)
+	require.NotContains(t, string(b), "agent-secret-token")
+	require.NotContains(t, string(b), "agent-secret-password")
+}
+
+func TestRunEnv(t *testing.T) {
+	dag, err := controller.FromConfig(testConfig("agent_run_env.yaml"))
+	require.NoError(t, err)
+	status, err := testDAG(t, dag)
+	require.Error(t, err)
+	require.Equal(t, scheduler.SchedulerStatus_Error, status.Status)
+
+	require.Equal(t, "run env 1", status.Nodes[0].OutputValue)
+	require.Equal(t, "checked", status.Nodes[1].OutputValue)
+	require.Equal(t, "failed 2", status.OnFailure.OutputValue)
+}
+
 func TestOnExit(t *testing.T) {
 	dag, err := controller.FromConfig(testConfig("agent_on_exit.yaml"))
 	require.NoError(t, err)
@@ -180,6 +357,45 @@ func TestRetry(t *testing.T) {
 	}
 }
 
+func TestSubDAG(t *testing.T) {
+	dag, err := controller.FromConfig(testConfig("agent_sub_dag.yaml"))
+	require.NoError(t, err)
+
+	status, err := testDAG(t, dag)
+	require.NoError(t, err)
+	require.Equal(t, scheduler.SchedulerStatus_Success, status.Status)
+
+	node := status.Nodes[0]
+	require.Equal(t, scheduler.NodeStatusSuccess, node.Status)
+	require.NotEqual(t, "", node.SubRequestId)
+
+	child, err := controller.FromConfig(testConfig("agent_sub_dag_child.yaml"))
+	require.NoError(t, err)
+
+	childStatus, err := controller.New(child.Config).GetStatusByRequestId(node.SubRequestId)
+	require.NoError(t, err)
+	require.Equal(t, scheduler.SchedulerStatus_Success, childStatus.Status)
+	require.Equal(t, "sub-param", childStatus.Params)
+
+	// the secrets are passed to the sub DAG through the environment
+	dag, err = controller.FromConfig(testConfig("agent_sub_dag_secret.yaml"))
+	require.NoError(t, err)
+	status, err = testDAG(t, dag)
+	require.NoError(t, err)
+	childStatus, err = controller.New(child.Config).GetStatusByRequestId(status.Nodes[0].SubRequestId)
+	require.NoError(t, err)
+	require.Equal(t, scheduler.SchedulerStatus_Success, childStatus.Status)
+	require.Equal(t, "${secret:TOKEN}", childStatus.Params)
+
+	// the sub DAG fails with the default parameter
+	dag, err = controller.FromConfig(testConfig("agent_sub_dag.yaml"))
+	require.NoError(t, err)
+	dag.Config.Steps[0].Params = ""
+	status, err = testDAG(t, dag)
+	require.Error(t, err)
+	require.Equal(t, scheduler.NodeStatusError, status.Nodes[0].Status)
+}
+
 func TestHandleHTTP(t *testing.T) {
 	dag, err := controller.FromConfig(testConfig("agent_handle_http.yaml"))
 	require.NoError(t, err)
@@ -222,6 +438,37 @@ func TestHandleHTTP(t *testing.T) {
 	a.handleHTTP(&mockResponseWriter, r)
 	require.Equal(t, http.StatusNotFound, mockResponseWriter.status)
 
+	// pause
+	r = &http.Request{
+		Method: "POST",
+		URL: &url.URL{
+			Path: "/pause",
+		},
+	}
+	a.handleHTTP(&mockResponseWriter, r)
+	require.Equal(t, http.StatusOK, mockResponseWriter.status)
+	require.Equal(t, "OK", mockResponseWriter.body)
+	require.Equal(t, scheduler.SchedulerStatus_Paused, a.Status().Status)
+	// written to the status file too
+	saved, err := database.ParseFile(a.dbFile)
+	require.NoError(t, err)
+	require.Equal(t, scheduler.SchedulerStatus_Paused, saved.Status)
+
+	// resume
+	r = &http.Request{
+		Method: "POST",
+		URL: &url.URL{
+			Path: "/resume",
+		},
+	}
+	a.handleHTTP(&mockResponseWriter, r)
+	require.Equal(t, http.StatusOK, mockResponseWriter.status)
+	require.Equal(t, "OK", mockResponseWriter.body)
+	require.Equal(t, scheduler.SchedulerStatus_Running, a.Status().Status)
+	saved, err = database.ParseFile(a.dbFile)
+	require.NoError(t, err)
+	require.Equal(t, scheduler.SchedulerStatus_Running, saved.Status)
+
 	// cancel
 	r = &http.Request{
 		Method: "POST",
@@ -2,53 +2,222 @@ package config
 
 import (
 	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
 
 	"github.com/yohamta/dagu/internal/utils"
 )
 
+// Condition is a precondition of a DAG or a step.
+// Exactly one of Condition, Command and FileExists is set.
 type Condition struct {
-	Condition string
-	Expected  string
+	Condition  string
+	Expected   string
+	Operator   string
+	Command    string
+	FileExists string
 }
 
 type ConditionResult struct {
-	Condition string
-	Expected  string
-	Actual    string
+	Condition  string
+	Expected   string
+	Operator   string
+	Command    string
+	FileExists string
+	Actual     string
+	Met        bool
+	Error      string
 }
 
+const (
+	OperatorEqual        = "=="
+	OperatorNotEqual     = "!="
+	OperatorMatch        = "=~"
+	OperatorNotMatch     = "!~"
+	OperatorLess         = "<"
+	OperatorLessEqual    = "<="
+	OperatorGreater      = ">"
+	OperatorGreaterEqual = ">="
+)
+
+var operators = map[string]bool{
+	OperatorEqual:        true,
+	OperatorNotEqual:     true,
+	OperatorMatch:        true,
+	OperatorNotMatch:     true,
+	OperatorLess:         true,
+	OperatorLessEqual:    true,
+	OperatorGreater:      true,
+	OperatorGreaterEqual: true,
+}
+
+func (c *Condition) validate() error {
+	specified := 0
+	for _, v := range []string{c.Condition, c.Command, c.FileExists} {
+		if v != "" {
+			specified++
+		}
+	}
+	if specified != 1 {
+		return fmt.Errorf("exactly one of condition, command and fileExists must be specified for a precondition")
+	}
+	if c.Condition == "" {
+		if c.Operator != "" || c.Expected != "" {
+			return fmt.Errorf("operator and expected can be used only with condition")
+		}
+		return nil
+	}
+	if c.Operator != "" && !operators[c.Operator] {
+		return fmt.Errorf("invalid operator %q in precondition", c.Operator)
+	}
+	if c.Operator == OperatorMatch || c.Operator == OperatorNotMatch {
+		if _, err := regexp.Compile(c.Expected); err != nil {
+			return fmt.Errorf("invalid regular expression %q in precondition: %w", c.Expected, err)
+		}
+	}
+	return nil
+}
+
+// Eval evaluates the condition. The returned error is not nil
+// only when the condition can not be evaluated.
 func (c *Condition) Eval() (*ConditionResult, error) {
-	ret, err := utils.ParseVariable(c.Condition)
+	return c.eval(nil)
+}
+
+// eval evaluates the condition with the variables in env
+// given as NAME=VALUE added to the environment of the process.
+func (c *Condition) eval(env []string) (*ConditionResult, error) {
+	r := &ConditionResult{
+		Condition:  c.Condition,
+		Expected:   c.Expected,
+		Operator:   c.Operator,
+		Command:    c.Command,
+		FileExists: c.FileExists,
+	}
+	var err error
+	switch {
+	case c.Command != "":
+		r.Actual, r.Met = evalCommand(c.Command, env)
+	case c.FileExists != "":
+		f := utils.ExpandEnvWith(c.FileExists, env)
+		r.Met = utils.FileExists(f)
+		r.Actual = strconv.FormatBool(r.Met)
+	default:
+		r.Actual, err = utils.ParseVariableWithEnv(c.Condition, env)
+		if err == nil {
+			r.Met, err = compare(r.Actual, c.Operator, c.Expected)
+		}
+	}
 	if err != nil {
-		return nil, err
+		r.Error = err.Error()
+		return r, err
 	}
-	return &ConditionResult{
-		Condition: c.Condition,
-		Expected:  c.Expected,
-		Actual:    ret,
-	}, nil
+	return r, nil
+}
+
+// evalCommand runs the command through the shell and returns
+// the exit code and whether it exited with 0.
+func evalCommand(command string, env []string) (string, bool) {
+	cmd := exec.Command("sh", "-c", command)
+	if len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
+	err := cmd.Run()
+	if err == nil {
+		return "0", true
+	}
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		return strconv.Itoa(exitErr.ExitCode()), false
+	}
+	return err.Error(), false
+}
+
+func compare(actual, operator, expected string) (bool, error) {
+	switch operator {
+	case "", OperatorEqual:
+		return actual == expected, nil
+	case OperatorNotEqual:
+		return actual != expected, nil
+	case OperatorMatch, OperatorNotMatch:
+		matched, err := regexp.MatchString(expected, actual)
+		if err != nil {
+			return false, err
+		}
+		return matched == (operator == OperatorMatch), nil
+	}
+	a, err := strconv.ParseFloat(strings.TrimSpace(actual), 64)
+	if err != nil {
+		return false, fmt.Errorf("%q is not a number", actual)
+	}
+	e, err := strconv.ParseFloat(strings.TrimSpace(expected), 64)
+	if err != nil {
+		return false, fmt.Errorf("%q is not a number", expected)
+	}
+	switch operator {
+	case OperatorLess:
+		return a < e, nil
+	case OperatorLessEqual:
+		return a <= e, nil
+	case OperatorGreater:
+		return a > e, nil
+	case OperatorGreaterEqual:
+		return a >= e, nil
+	}
+	return false, fmt.Errorf("invalid operator %q", operator)
+}
+
+func (r *ConditionResult) String() string {
+	switch {
+	case r.Command != "":
+		return fmt.Sprintf("Command=%s ExitCode=%s", r.Command, r.Actual)
+	case r.FileExists != "":
+		return fmt.Sprintf("FileExists=%s Actual=%s", r.FileExists, r.Actual)
+	}
+	op := r.Operator
+	if op == "" {
+		op = OperatorEqual
+	}
+	return fmt.Sprintf("Condition=%s Operator=%s Expected=%s Actual=%s",
+		r.Condition, op, r.Expected, r.Actual)
 }
 
 func EvalCondition(c *Condition) error {
 	r, err := c.Eval()
+	return checkResult(r, err)
+}
+
+func checkResult(r *ConditionResult, err error) error {
 	if err != nil {
 		return fmt.Errorf(
-			"failed to evaluate condition. Condition=%s Error=%v",
-			c.Condition, err)
+			"failed to evaluate condition. %s Error=%v", r, err)
 	}
-	if r.Expected != r.Actual {
-		return fmt.Errorf(
-			"condition was not met. Condition=%s Expected=%s Actual=%s",
-			r.Condition, r.Expected, r.Actual)
+	if !r.Met {
+		return fmt.Errorf("condition was not met. %s", r)
 	}
+	return nil
+}
+
+// EvalConditions evaluates the conditions with the variables in env
+// and returns an error if any of them is not met.
+func EvalConditions(cond []*Condition, env []string) error {
+	_, err := CheckConditions(cond, env)
 	return err
 }
 
-func EvalConditions(cond []*Condition) error {
+// CheckConditions evaluates the conditions in order until one of
+// them is not met and returns the results of the evaluated ones.
+// The variables in env are passed to the commands of the conditions.
+func CheckConditions(cond []*Condition, env []string) ([]*ConditionResult, error) {
+	var ret []*ConditionResult
 	for _, c := range cond {
-		if err := EvalCondition(c); err != nil {
-			return err
+		r, err := c.eval(env)
+		ret = append(ret, r)
+		if err := checkResult(r, err); err != nil {
+			return ret, err
 		}
 	}
-	return nil
+	return ret, nil
 }
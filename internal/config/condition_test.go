@@ -34,6 +34,78 @@ func TestCondition(t *testing.T) {
 	}
 }
 
+func TestConditionOperators(t *testing.T) {
+	os.Setenv("TEST_CONDITION", "100")
+	tmpFile, err := os.CreateTemp("", "condition_test")
+	require.NoError(t, err)
+	tmpFile.Close()
+	defer os.Remove(tmpFile.Name())
+
+	for _, test := range []struct {
+		Condition *Condition
+		Met       bool
+	}{
+		{&Condition{Condition: "$TEST_CONDITION", Operator: "==", Expected: "100"}, true},
+		{&Condition{Condition: "$TEST_CONDITION", Operator: "!=", Expected: "100"}, false},
+		{&Condition{Condition: "$TEST_CONDITION", Operator: "!=", Expected: "1"}, true},
+		{&Condition{Condition: "$TEST_CONDITION", Operator: "=~", Expected: "^1[0-9]+$"}, true},
+		{&Condition{Condition: "$TEST_CONDITION", Operator: "!~", Expected: "^1[0-9]+$"}, false},
+		{&Condition{Condition: "$TEST_CONDITION", Operator: "<", Expected: "99.5"}, false},
+		{&Condition{Condition: "$TEST_CONDITION", Operator: "<=", Expected: "100"}, true},
+		{&Condition{Condition: "$TEST_CONDITION", Operator: ">", Expected: "20"}, true},
+		{&Condition{Condition: "$TEST_CONDITION", Operator: ">=", Expected: "101"}, false},
+		{&Condition{Command: "test 1 -eq 1 && true"}, true},
+		{&Condition{Command: "exit 3"}, false},
+		{&Condition{FileExists: tmpFile.Name()}, true},
+		{&Condition{FileExists: tmpFile.Name() + "_not_exist"}, false},
+	} {
+		require.NoError(t, test.Condition.validate())
+		ret, err := test.Condition.Eval()
+		require.NoError(t, err)
+		require.Equal(t, test.Met, ret.Met, ret.String())
+	}
+
+	ret, err := (&Condition{Command: "exit 3"}).Eval()
+	require.NoError(t, err)
+	require.Equal(t, "3", ret.Actual)
+
+	_, err = (&Condition{Condition: "abc", Operator: ">", Expected: "1"}).Eval()
+	require.Error(t, err)
+
+	for _, c := range []*Condition{
+		{Condition: "a", Operator: "<>", Expected: "1"},
+		{Condition: "a", Operator: "=~", Expected: "("},
+		{Condition: "a", Command: "true"},
+		{Command: "true", Expected: "1"},
+		{},
+	} {
+		require.Error(t, c.validate())
+	}
+}
+
+func TestCheckConditions(t *testing.T) {
+	ret, err := CheckConditions([]*Condition{
+		{Condition: "`echo 1`", Expected: "1"},
+		{Condition: "`echo 2`", Operator: ">", Expected: "5"},
+		{Condition: "`echo 3`", Expected: "3"},
+	}, nil)
+	require.Error(t, err)
+	require.Len(t, ret, 2)
+	require.True(t, ret[0].Met)
+	require.False(t, ret[1].Met)
+	require.Equal(t, "2", ret[1].Actual)
+
+	// the variables are passed to the commands
+	env := []string{"COND_VAR=value"}
+	ret, err = CheckConditions([]*Condition{
+		{Condition: "`printenv COND_VAR`", Expected: "value"},
+		{Command: `test "$COND_VAR" = value`},
+	}, env)
+	require.NoError(t, err)
+	require.Len(t, ret, 2)
+	require.Equal(t, "", os.Getenv("COND_VAR"))
+}
+
 func TestEvalConditions(t *testing.T) {
 	for scenario, test := range map[string]struct {
 		Conditions []*Condition
@@ -67,7 +139,7 @@ func TestEvalConditions(t *testing.T) {
 		},
 	} {
 		t.Run(scenario, func(t *testing.T) {
-			err := EvalConditions(test.Conditions)
+			err := EvalConditions(test.Conditions, nil)
 			if test.Want {
 				require.NoError(t, err)
 			} else {
@@ -1,14 +1,16 @@
 package config
 
 import (
-	"encoding/csv"
+	"errors"
 	"fmt"
 	"os"
 	"path"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/robfig/cron/v3"
 	"github.com/yohamta/dagu/internal/constants"
 	"github.com/yohamta/dagu/internal/settings"
 	"github.com/yohamta/dagu/internal/utils"
@@ -18,6 +20,8 @@ type Config struct {
 	ConfigPath        string
 	Name              string
 	Description       string
+	Schedule          []cron.Schedule
+	ScheduleExp       []string
 	Env               []string
 	LogDir            string
 	HandlerOn         HandlerOn
@@ -32,9 +36,29 @@ type Config struct {
 	MaxActiveRuns     int
 	Params            []string
 	DefaultParams     string
+	NamedParams       []*Param
 	MaxCleanUpTime    time.Duration
+	Timeout           time.Duration
+	Shell             string
+	Secrets           []string
+	SecretValues      map[string]string `json:"-"`
+	InheritEnv        *InheritEnv
+	// Pools are defined in the global config.
+	Pools []*PoolConfig
+	// OverlapPolicy decides what to do when the DAG is started
+	// while it is running: skip, queue or parallel.
+	OverlapPolicy string
 }
 
+const (
+	// OverlapSkip rejects the run while the DAG is running.
+	OverlapSkip = "skip"
+	// OverlapQueue queues the run to start when the running one ends.
+	OverlapQueue = "queue"
+	// OverlapParallel runs the DAG alongside the running ones.
+	OverlapParallel = "parallel"
+)
+
 type HandlerOn struct {
 	Failure *Step
 	Success *Step
@@ -68,6 +92,9 @@ func (c *Config) setup(file string) {
 	if c.MaxCleanUpTime == 0 {
 		c.MaxCleanUpTime = time.Minute * 5
 	}
+	if c.OverlapPolicy == "" {
+		c.OverlapPolicy = OverlapSkip
+	}
 	dir := path.Dir(file)
 	for _, step := range c.Steps {
 		c.setupStep(step, dir)
@@ -90,6 +117,26 @@ func (c *Config) setupStep(step *Step, defaultDir string) {
 	if step.Dir == "" {
 		step.Dir = path.Dir(c.ConfigPath)
 	}
+	if step.Run != "" && !path.IsAbs(step.Run) {
+		step.Run = path.Join(defaultDir, step.Run)
+	}
+	if step.Shell == "" {
+		step.Shell = c.Shell
+	}
+	step.InheritEnv = c.InheritEnv
+}
+
+// NextRun returns the earliest scheduled time after t.
+// It returns the zero time if the DAG has no schedule.
+func (c *Config) NextRun(t time.Time) time.Time {
+	var ret time.Time
+	for _, s := range c.Schedule {
+		next := s.Next(t)
+		if ret.IsZero() || next.Before(ret) {
+			ret = next
+		}
+	}
+	return ret
 }
 
 func (c *Config) Clone() *Config {
@@ -124,27 +171,90 @@ func buildFromDefinition(def *configDefinition, globalConfig *Config,
 	c.MailOn.Failure = def.MailOn.Failure
 	c.MailOn.Success = def.MailOn.Success
 	c.Delay = time.Second * time.Duration(def.DelaySec)
+	switch def.OverlapPolicy {
+	case "", OverlapSkip, OverlapQueue, OverlapParallel:
+		c.OverlapPolicy = def.OverlapPolicy
+	default:
+		return nil, fmt.Errorf("invalid overlapPolicy %q", def.OverlapPolicy)
+	}
+
+	c.ScheduleExp, c.Schedule, err = parseSchedule(def.Schedule)
+	if err != nil {
+		return nil, err
+	}
 
 	if opts != nil && opts.headOnly {
 		return c, nil
 	}
 
-	env, err := loadVariables(def.Env)
+	dotenvFiles, err := toStringList(def.Dotenv)
+	if err != nil {
+		return nil, fmt.Errorf("dotenv: %w", err)
+	}
+	dotenv, err := loadDotenv(dotenvFiles)
 	if err != nil {
 		return nil, err
 	}
+	fileSecrets := map[string]string{}
+	if def.SecretsFile != "" {
+		fileSecrets, err = loadSecretsFile(def.SecretsFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	p := ""
+	if opts != nil {
+		p = opts.parameters
+	}
+	secrets, err := secretNames(def, p, globalConfig)
+	if err != nil {
+		return nil, err
+	}
+	for k := range fileSecrets {
+		secrets[k] = true
+	}
 
-	c.Env = buildConfigEnv(env)
+	// the variables are evaluated in the scope of the DAG in the order
+	// of the global config, the dotenv files and env so that the later
+	// ones can refer to and override the former ones
+	scope := newEnvScope()
+	scope.secrets = secrets
 	if globalConfig != nil {
 		for _, e := range globalConfig.Env {
-			key := strings.SplitN(e, "=", 2)[0]
-			if _, ok := env[key]; !ok {
-				c.Env = append(c.Env, e)
+			kv := strings.SplitN(e, "=", 2)
+			if len(kv) == 2 && !secrets[kv[0]] {
+				scope.set(kv[0], kv[1])
 			}
 		}
 	}
+	for _, k := range sortedKeys(dotenv) {
+		if !secrets[k] {
+			scope.set(k, dotenv[k])
+		}
+	}
+	envVars, err := parseEnv(def.Env)
+	if err != nil {
+		return nil, err
+	}
+	env, err := loadVariables(envVars, scope, secrets)
+	if err != nil {
+		return nil, err
+	}
+	for _, vars := range []map[string]string{dotenv, fileSecrets} {
+		for k, v := range vars {
+			if _, ok := env[k]; !ok {
+				env[k] = v
+			}
+		}
+	}
+	c.Env = scope.variables()
+	c.InheritEnv, err = buildInheritEnv(def.InheritEnv)
+	if err != nil {
+		return nil, err
+	}
 
-	logDir, err := utils.ParseVariable(def.LogDir)
+	logDir, err := scope.parse(def.LogDir)
 	if err != nil {
 		return nil, err
 	}
@@ -153,25 +263,31 @@ func buildFromDefinition(def *configDefinition, globalConfig *Config,
 		c.HistRetentionDays = *def.HistRetentionDays
 	}
 
-	c.DefaultParams = def.Params
-	p := c.DefaultParams
-	if opts != nil && opts.parameters != "" {
-		p = opts.parameters
+	inherit := c.InheritEnv
+	if inherit == nil && globalConfig != nil {
+		inherit = globalConfig.InheritEnv
 	}
-
-	c.Params, err = parseParameters(p, true)
+	e := &expander{outputs: outputVariables(def.Steps), secrets: secrets, env: scope,
+		inherit: inherit}
+	e.params, err = c.buildParams(def.Params, p, scope)
 	if err != nil {
 		return nil, err
 	}
 
-	c.Steps, err = buildStepsFromDefinition(c.Env, def.Steps)
+	variables := c.Env
+	if len(c.NamedParams) > 0 {
+		// named parameters are passed to the steps as environment variables
+		variables = append(append([]string{}, c.Env...), c.Params...)
+	}
+
+	c.Steps, err = buildStepsFromDefinition(variables, def.Steps, e)
 	if err != nil {
 		return nil, err
 	}
 
 	if def.HandlerOn.Exit != nil {
 		def.HandlerOn.Exit.Name = constants.OnExit
-		c.HandlerOn.Exit, err = buildStep(c.Env, def.HandlerOn.Exit)
+		c.HandlerOn.Exit, err = buildStep(variables, def.HandlerOn.Exit, e)
 		if err != nil {
 			return nil, err
 		}
@@ -179,7 +295,7 @@ func buildFromDefinition(def *configDefinition, globalConfig *Config,
 
 	if def.HandlerOn.Success != nil {
 		def.HandlerOn.Success.Name = constants.OnSuccess
-		c.HandlerOn.Success, err = buildStep(c.Env, def.HandlerOn.Success)
+		c.HandlerOn.Success, err = buildStep(variables, def.HandlerOn.Success, e)
 		if err != nil {
 			return nil, err
 		}
@@ -187,7 +303,7 @@ func buildFromDefinition(def *configDefinition, globalConfig *Config,
 
 	if def.HandlerOn.Failure != nil {
 		def.HandlerOn.Failure.Name = constants.OnFailure
-		c.HandlerOn.Failure, err = buildStep(c.Env, def.HandlerOn.Failure)
+		c.HandlerOn.Failure, err = buildStep(variables, def.HandlerOn.Failure, e)
 		if err != nil {
 			return nil, err
 		}
@@ -195,7 +311,7 @@ func buildFromDefinition(def *configDefinition, globalConfig *Config,
 
 	if def.HandlerOn.Cancel != nil {
 		def.HandlerOn.Cancel.Name = constants.OnCancel
-		c.HandlerOn.Cancel, err = buildStep(c.Env, def.HandlerOn.Cancel)
+		c.HandlerOn.Cancel, err = buildStep(variables, def.HandlerOn.Cancel, e)
 		if err != nil {
 			return nil, err
 		}
@@ -213,44 +329,166 @@ func buildFromDefinition(def *configDefinition, globalConfig *Config,
 	if err != nil {
 		return nil, err
 	}
-	c.Preconditions = loadPreCondition(def.Preconditions)
+	c.Preconditions, err = loadPreCondition(def.Preconditions, e)
+	if err != nil {
+		return nil, err
+	}
+	c.setupSecrets(secrets, env, globalConfig)
 	c.MaxActiveRuns = def.MaxActiveRuns
+	c.Pools, err = buildPoolsFromDefinition(def.Pools)
+	if err != nil {
+		return nil, err
+	}
 
 	if def.MaxCleanUpTimeSec != nil {
 		c.MaxCleanUpTime = time.Second * time.Duration(*def.MaxCleanUpTimeSec)
 	}
+	c.Timeout = time.Second * time.Duration(def.TimeoutSec)
+	c.Shell = def.Shell
 
 	return c, nil
 }
 
-func parseParameters(value string, eval bool) ([]string, error) {
-	params := value
-	var err error
-	if eval {
-		params, err = utils.ParseCommand(os.ExpandEnv(value))
+func parseSchedule(value interface{}) ([]string, []cron.Schedule, error) {
+	var exps []string
+	switch v := value.(type) {
+	case nil:
+		return nil, nil, nil
+	case string:
+		exps = append(exps, v)
+	case []interface{}:
+		for _, e := range v {
+			s, ok := e.(string)
+			if !ok {
+				return nil, nil, fmt.Errorf("invalid schedule: %v", e)
+			}
+			exps = append(exps, s)
+		}
+	default:
+		return nil, nil, fmt.Errorf("invalid schedule type: %T", value)
+	}
+	var (
+		retExps []string
+		ret     []cron.Schedule
+	)
+	for _, exp := range exps {
+		exp = strings.TrimSpace(exp)
+		if exp == "" {
+			continue
+		}
+		s, err := cronParser.Parse(exp)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid schedule %q: %w", exp, err)
+		}
+		retExps = append(retExps, exp)
+		ret = append(ret, s)
+	}
+	return retExps, ret, nil
+}
+
+var cronParser = cron.NewParser(
+	cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor,
+)
+
+// buildParams sets the parameters of the DAG and returns their values
+// by the names to refer to them in the config, that is, $1, $2, ... for
+// the positional parameters and the names for the named parameters.
+// The given parameters override the default ones.
+func (c *Config) buildParams(value interface{}, params string, env *envScope) (map[string]string, error) {
+	ret := map[string]string{}
+	if s, ok := value.(string); ok || value == nil {
+		c.DefaultParams = s
+		if params == "" {
+			params = s
+		}
+		vals, err := splitParameters(params, env)
 		if err != nil {
 			return nil, err
 		}
+		for i, v := range vals {
+			ret[strconv.Itoa(i+1)] = v
+		}
+		c.Params = vals
+		return ret, nil
 	}
-	r := csv.NewReader(strings.NewReader(params))
-	r.Comma = ' '
-	records, err := r.ReadAll()
+
+	var err error
+	c.NamedParams, err = buildNamedParams(value)
 	if err != nil {
 		return nil, err
 	}
-	var ret []string
-	for _, r := range records {
-		for i, v := range r {
-			err = os.Setenv(strconv.Itoa(i+1), v)
-			if err != nil {
-				return nil, err
-			}
-			ret = append(ret, v)
+	ret, err = parseNamedParameters(params, c.NamedParams, env)
+	if err != nil {
+		return nil, err
+	}
+	var defaults []string
+	for _, p := range c.NamedParams {
+		if v, ok := ret[p.Name]; ok {
+			c.Params = append(c.Params, fmt.Sprintf("%s=%s", p.Name, v))
+		}
+		if p.Default != "" {
+			defaults = append(defaults, quoteParam(fmt.Sprintf("%s=%s", p.Name, p.Default)))
 		}
 	}
+	c.DefaultParams = strings.Join(defaults, " ")
 	return ret, nil
 }
 
+// quoteParam quotes the parameter if it contains spaces or quotes
+// so that it is read back as a single parameter.
+func quoteParam(p string) string {
+	if !strings.ContainsAny(p, " \"") {
+		return p
+	}
+	return fmt.Sprintf(`"%s"`, strings.ReplaceAll(p, `"`, `""`))
+}
+
+// expander expands the references to the parameters and the environment
+// variables in the config. The references to the output variables of
+// the steps, the secrets and the variables of the run context are kept
+// as they are to be expanded when the steps run. The variables of the
+// environment of the process not selected by inherit are expanded to
+// the empty string.
+type expander struct {
+	params  map[string]string
+	outputs map[string]bool
+	secrets map[string]bool
+	env     *envScope
+	inherit *InheritEnv
+}
+
+// positionalParams returns the values of the positional parameters
+// in order.
+func (e *expander) positionalParams() []string {
+	var ret []string
+	for i := 1; ; i++ {
+		v, ok := e.params[strconv.Itoa(i)]
+		if !ok {
+			return ret
+		}
+		ret = append(ret, v)
+	}
+}
+
+func (e *expander) expand(s string) string {
+	return os.Expand(s, func(k string) string {
+		if e.outputs[k] || e.secrets[k] || strings.HasPrefix(k, SecretRefPrefix) ||
+			constants.RunContextVariables[k] {
+			return fmt.Sprintf("${%s}", k)
+		}
+		if v, ok := e.params[k]; ok {
+			return v
+		}
+		if e.env != nil && e.env.has(k) {
+			return e.env.get(k)
+		}
+		if e.inherit != nil && !e.inherit.allows(k) {
+			return ""
+		}
+		return os.Getenv(k)
+	})
+}
+
 func buildSmtpConfigFromDefinition(def smtpConfigDef) (*SmtpConfig, error) {
 	smtp := &SmtpConfig{}
 	smtp.Host = def.Host
@@ -266,10 +504,28 @@ func buildMailConfigFromDefinition(def mailConfigDef) (*MailConfig, error) {
 	return c, nil
 }
 
-func buildStepsFromDefinition(variables []string, stepDefs []*stepDef) ([]*Step, error) {
+// outputVariables returns the names of the variables that steps
+// write their output to. References to these variables are kept
+// as they are when loading the config, and expanded when the
+// steps that use them are executed.
+func outputVariables(stepDefs []*stepDef) map[string]bool {
+	ret := map[string]bool{}
+	for _, def := range stepDefs {
+		if def.Output != "" {
+			ret[def.Output] = true
+		}
+		if def.Foreach != nil {
+			ret[ItemVariable] = true
+		}
+	}
+	return ret
+}
+
+func buildStepsFromDefinition(variables []string, stepDefs []*stepDef,
+	e *expander) ([]*Step, error) {
 	var ret []*Step
 	for _, def := range stepDefs {
-		step, err := buildStep(variables, def)
+		step, err := buildStep(variables, def, e)
 		if err != nil {
 			return nil, err
 		}
@@ -278,15 +534,61 @@ func buildStepsFromDefinition(variables []string, stepDefs []*stepDef) ([]*Step,
 	return ret, nil
 }
 
-func buildStep(variables []string, def *stepDef) (*Step, error) {
+func buildStep(variables []string, def *stepDef, e *expander) (*Step, error) {
 	if err := assertStepDef(def); err != nil {
 		return nil, err
 	}
+	if def.Env != nil {
+		// the variables of the step are evaluated in a copy of
+		// the scope of the DAG and override the variables of the DAG
+		vars, err := parseEnv(def.Env)
+		if err != nil {
+			return nil, fmt.Errorf("step %s: %w", def.Name, err)
+		}
+		for _, v := range vars {
+			if e.secrets[v.key] {
+				return nil, fmt.Errorf("step %s: secret %s can not be defined in the env of a step",
+					def.Name, v.key)
+			}
+		}
+		scope := newEnvScope()
+		if e.env != nil {
+			scope = e.env.clone()
+		}
+		values, err := loadVariables(vars, scope, nil)
+		if err != nil {
+			return nil, err
+		}
+		se := *e
+		se.env = scope
+		e = &se
+		variables = overrideVariables(variables, vars, values)
+	}
 	step := &Step{}
 	step.Name = def.Name
 	step.Description = def.Description
-	step.Command, step.Args = utils.SplitCommand(def.Command)
-	step.Dir = os.ExpandEnv(def.Dir)
+	step.Script = def.Script
+	if def.Command != "" {
+		var err error
+		step.Command, step.Args, err = utils.SplitCommandWith(def.Command, e.expand)
+		if errors.Is(err, utils.ErrShellOperators) {
+			// the command is run by the shell as a script, which
+			// expands the variables from the environment of the step
+			// and the positional parameters from its arguments. The
+			// command is kept expanded to show what runs.
+			step.Command, step.Args, err = e.expand(def.Command), nil, nil
+			step.Script = def.Command
+			step.ScriptArgs = e.positionalParams()
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	step.Shell = def.Shell
+	step.Run = e.expand(def.Run)
+	step.Params = e.expand(def.Params)
+	step.Dir = e.expand(def.Dir)
+	step.Output = def.Output
 	step.Variables = variables
 	step.Depends = def.Depends
 	if def.ContinueOn != nil {
@@ -295,7 +597,11 @@ func buildStep(variables []string, def *stepDef) (*Step, error) {
 	}
 	if def.RetryPolicy != nil {
 		step.RetryPolicy = &RetryPolicy{
-			Limit: def.RetryPolicy.Limit,
+			Limit:       def.RetryPolicy.Limit,
+			Interval:    time.Second * time.Duration(def.RetryPolicy.IntervalSec),
+			Backoff:     def.RetryPolicy.Backoff,
+			MaxInterval: time.Second * time.Duration(def.RetryPolicy.MaxIntervalSec),
+			ExitCodes:   def.RetryPolicy.ExitCodes,
 		}
 	}
 	if def.RepeatPolicy != nil {
@@ -303,41 +609,76 @@ func buildStep(variables []string, def *stepDef) (*Step, error) {
 		step.RepeatPolicy.Interval = time.Second * time.Duration(def.RepeatPolicy.IntervalSec)
 	}
 	step.MailOnError = def.MailOnError
-	step.Preconditions = loadPreCondition(def.Preconditions)
+	var err error
+	step.Preconditions, err = loadPreCondition(def.Preconditions, e)
+	if err != nil {
+		return nil, err
+	}
+	step.Timeout = time.Second * time.Duration(def.TimeoutSec)
+	switch v := def.Foreach.(type) {
+	case nil:
+	case string:
+		step.ForeachFrom = e.expand(v)
+	case []interface{}:
+		for _, item := range v {
+			step.Foreach = append(step.Foreach, e.expand(fmt.Sprint(item)))
+		}
+	}
+	step.MaxParallel = def.MaxParallel
+	if def.SignalOnStop != "" {
+		if _, ok := SignalByName(def.SignalOnStop); !ok {
+			return nil, fmt.Errorf("step %s: invalid signalOnStop %q", def.Name, def.SignalOnStop)
+		}
+		step.SignalOnStop = normalizeSignal(def.SignalOnStop)
+	}
+	step.Priority = def.Priority
+	step.Weight = def.Weight
+	step.Pool = def.Pool
 	return step, nil
 }
 
-func buildConfigEnv(vars map[string]string) []string {
+func sortedKeys(m map[string]string) []string {
 	var ret []string
-	for k, v := range vars {
-		ret = append(ret, fmt.Sprintf("%s=%s", k, v))
+	for k := range m {
+		ret = append(ret, k)
 	}
+	sort.Strings(ret)
 	return ret
 }
 
-func loadPreCondition(cond []*conditionDef) []*Condition {
+func loadPreCondition(cond []*conditionDef, e *expander) ([]*Condition, error) {
 	var ret []*Condition
 	for _, v := range cond {
-		ret = append(ret, &Condition{
-			Condition: v.Condition,
-			Expected:  v.Expected,
-		})
+		c := &Condition{
+			Condition:  e.expand(v.Condition),
+			Expected:   e.expand(v.Expected),
+			Operator:   v.Operator,
+			Command:    e.expand(v.Command),
+			FileExists: e.expand(v.FileExists),
+		}
+		if err := c.validate(); err != nil {
+			return nil, err
+		}
+		ret = append(ret, c)
 	}
-	return ret
+	return ret, nil
 }
 
-func loadVariables(strVariables map[string]string) (map[string]string, error) {
+// loadVariables evaluates the variables in order in the scope.
+// It returns the values of the variables by name.
+func loadVariables(envVars []*envVar, scope *envScope, secrets map[string]bool) (map[string]string, error) {
 	vars := map[string]string{}
-	for k, v := range strVariables {
-		parsed, err := utils.ParseVariable(v)
+	for _, e := range envVars {
+		parsed, err := scope.parse(e.value)
 		if err != nil {
 			return nil, err
 		}
-		vars[k] = parsed
-		err = os.Setenv(k, parsed)
-		if err != nil {
-			return nil, err
+		vars[e.key] = parsed
+		if secrets[e.key] {
+			// secrets are passed only to the steps
+			continue
 		}
+		scope.set(e.key, parsed)
 	}
 	return vars, nil
 }
@@ -349,6 +690,19 @@ func assertDef(def *configDefinition) error {
 	if len(def.Steps) == 0 {
 		return fmt.Errorf("at least one step must be specified")
 	}
+	if def.TimeoutSec < 0 {
+		return fmt.Errorf("timeoutSec must not be negative")
+	}
+	if def.Pools != nil {
+		return fmt.Errorf("pools can be defined only in the global config")
+	}
+	names := map[string]bool{}
+	for _, s := range def.Steps {
+		if names[s.Name] {
+			return fmt.Errorf("duplicate step name: %s", s.Name)
+		}
+		names[s.Name] = true
+	}
 	return nil
 }
 
@@ -356,8 +710,59 @@ func assertStepDef(def *stepDef) error {
 	if def.Name == "" {
 		return fmt.Errorf("step name must be specified")
 	}
-	if def.Command == "" {
+	specified := 0
+	for _, v := range []string{def.Command, def.Run, def.Script} {
+		if v != "" {
+			specified++
+		}
+	}
+	if specified == 0 {
 		return fmt.Errorf("step command must be specified")
 	}
+	if specified > 1 {
+		return fmt.Errorf("only one of step command, run and script can be specified")
+	}
+	if def.TimeoutSec < 0 {
+		return fmt.Errorf("step timeoutSec must not be negative")
+	}
+	if p := def.RetryPolicy; p != nil {
+		if p.IntervalSec < 0 || p.MaxIntervalSec < 0 {
+			return fmt.Errorf("retryPolicy intervalSec and maxIntervalSec must not be negative")
+		}
+		if p.Backoff != 0 && p.Backoff < 1 {
+			return fmt.Errorf("retryPolicy backoff must be greater than or equal to 1")
+		}
+	}
+	switch v := def.Foreach.(type) {
+	case nil:
+		if def.MaxParallel != 0 {
+			return fmt.Errorf("maxParallel can be used only with foreach")
+		}
+	case string:
+		if v == "" {
+			return fmt.Errorf("step foreach must not be empty")
+		}
+	case []interface{}:
+		if len(v) == 0 {
+			return fmt.Errorf("step foreach must not be empty")
+		}
+		for _, item := range v {
+			switch item.(type) {
+			case map[interface{}]interface{}, []interface{}, nil:
+				return fmt.Errorf("step foreach must be a list of values")
+			}
+		}
+	default:
+		return fmt.Errorf("step foreach must be a list or a string")
+	}
+	if def.Foreach != nil && def.Output != "" {
+		return fmt.Errorf("output can not be used with foreach")
+	}
+	if def.MaxParallel < 0 {
+		return fmt.Errorf("step maxParallel must not be negative")
+	}
+	if def.Weight < 0 {
+		return fmt.Errorf("step weight must not be negative")
+	}
 	return nil
 }
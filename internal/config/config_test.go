@@ -1,10 +1,14 @@
 package config
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
 	"path"
+	"strings"
+	"syscall"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 	"github.com/yohamta/dagu/internal/settings"
@@ -21,8 +25,8 @@ var (
 func TestMain(m *testing.M) {
 	settings.InitTest(testHomeDir)
 	testEnv = []string{
-		fmt.Sprintf("LOG_DIR=%s", path.Join(testHomeDir, "/logs")),
 		fmt.Sprintf("PATH=%s", os.ExpandEnv("${PATH}")),
+		fmt.Sprintf("LOG_DIR=%s", path.Join(testHomeDir, "/logs")),
 	}
 	code := m.Run()
 	os.Exit(code)
@@ -80,13 +84,560 @@ func TestConfigLoadHeadOnly(t *testing.T) {
 	require.True(t, len(cfg.Steps) == 0)
 }
 
+func TestConfigSchedule(t *testing.T) {
+	l := &Loader{
+		HomeDir: utils.MustGetUserHomeDir(),
+	}
+
+	cfg, err := l.LoadHeadOnly(path.Join(testDir, "config_schedule.yaml"))
+	require.NoError(t, err)
+
+	require.Equal(t, []string{"0 1 * * *", "30 12 * * 1-5"}, cfg.ScheduleExp)
+	require.Equal(t, 2, len(cfg.Schedule))
+
+	// Sunday
+	tm := time.Date(2022, 5, 1, 10, 0, 0, 0, time.Local)
+	require.Equal(t, time.Date(2022, 5, 2, 1, 0, 0, 0, time.Local), cfg.NextRun(tm))
+
+	// Monday
+	tm = time.Date(2022, 5, 2, 10, 0, 0, 0, time.Local)
+	require.Equal(t, time.Date(2022, 5, 2, 12, 30, 0, 0, time.Local), cfg.NextRun(tm))
+
+	cfg, err = l.LoadHeadOnly(path.Join(testDir, "config_default.yaml"))
+	require.NoError(t, err)
+	require.True(t, cfg.NextRun(tm).IsZero())
+}
+
+func TestConfigSubDAG(t *testing.T) {
+	l := &Loader{
+		HomeDir: utils.MustGetUserHomeDir(),
+	}
+
+	cfg, err := l.Load(path.Join(testDir, "agent_sub_dag.yaml"), "")
+	require.NoError(t, err)
+
+	step := cfg.Steps[0]
+	require.Equal(t, path.Join(testDir, "agent_sub_dag_child.yaml"), step.Run)
+	require.Equal(t, "sub-param", step.Params)
+	require.Equal(t, "", step.Command)
+}
+
+func TestConfigOutput(t *testing.T) {
+	l := &Loader{
+		HomeDir: utils.MustGetUserHomeDir(),
+	}
+
+	cfg, err := l.Load(path.Join(testDir, "config_output.yaml"), "")
+	require.NoError(t, err)
+
+	require.Equal(t, "OUT1", cfg.Steps[0].Output)
+	require.Equal(t, "echo", cfg.Steps[1].Command)
+	require.Equal(t, []string{"${OUT1}"}, cfg.Steps[1].Args)
+	require.Equal(t, "${OUT1}", cfg.Steps[1].Dir)
+}
+
+func TestConfigScript(t *testing.T) {
+	l := &Loader{
+		HomeDir: utils.MustGetUserHomeDir(),
+	}
+
+	cfg, err := l.Load(path.Join(testDir, "config_script.yaml"), "")
+	require.NoError(t, err)
+
+	require.Equal(t, "echo hello | grep hello\necho done\n", cfg.Steps[0].Script)
+	require.Equal(t, "bash", cfg.Steps[0].Shell)
+	require.Equal(t, "python3", cfg.Steps[1].Shell)
+	require.Equal(t, "echo", cfg.Steps[2].Command)
+	require.Equal(t, []string{"hello world", "a b"}, cfg.Steps[2].Args)
+
+	// the command with shell operators is run by the shell
+	require.Equal(t, "echo hello | grep hello > /dev/null", cfg.Steps[3].Command)
+	require.Equal(t, "echo hello | grep hello > /dev/null", cfg.Steps[3].Script)
+	require.Equal(t, "bash", cfg.Steps[3].Shell)
+
+	// with the positional parameters as the arguments
+	require.Equal(t, `echo foo "bar baz" | cat`, cfg.Steps[4].Command)
+	require.Equal(t, `echo $1 "$2" | cat`, cfg.Steps[4].Script)
+	require.Equal(t, []string{"foo", "bar baz"}, cfg.Steps[4].ScriptArgs)
+}
+
+func TestConfigForeach(t *testing.T) {
+	l := &Loader{
+		HomeDir: utils.MustGetUserHomeDir(),
+	}
+
+	cfg, err := l.Load(path.Join(testDir, "config_foreach.yaml"), "")
+	require.NoError(t, err)
+
+	require.Equal(t, "${TENANTS}", cfg.Steps[1].ForeachFrom)
+	require.Equal(t, []string{"${ITEM}"}, cfg.Steps[1].Args)
+	require.Equal(t, []string{"a", "b", "1"}, cfg.Steps[2].Foreach)
+	require.Equal(t, 2, cfg.Steps[2].MaxParallel)
+	require.True(t, cfg.Steps[2].IsForeach())
+	require.False(t, cfg.Steps[0].IsForeach())
+}
+
+func TestConfigWeight(t *testing.T) {
+	l := &Loader{
+		HomeDir: utils.MustGetUserHomeDir(),
+	}
+
+	cfg, err := l.Load(path.Join(testDir, "config_weight.yaml"), "")
+	require.NoError(t, err)
+
+	require.Equal(t, 0, cfg.Steps[0].Priority)
+	require.Equal(t, 1, cfg.Steps[0].Slots())
+	require.Equal(t, 10, cfg.Steps[1].Priority)
+	require.Equal(t, 3, cfg.Steps[1].Slots())
+	// runs alone
+	require.Equal(t, 5, cfg.Steps[2].Slots())
+}
+
+func TestConfigPool(t *testing.T) {
+	l := &Loader{
+		HomeDir: utils.MustGetUserHomeDir(),
+	}
+
+	cfg, err := l.Load(path.Join(testDir, "config_pool.yaml"), "")
+	require.NoError(t, err)
+	require.Equal(t, "db", cfg.Steps[0].Pool)
+	require.Equal(t, []*PoolConfig{{Name: "db", Size: 2}}, cfg.Pools)
+
+	_, err = l.Load(path.Join(testDir, "config_err_pool.yaml"), "")
+	require.Equal(t, fmt.Errorf("step export: pool unknown is not defined"), err)
+
+	_, err = l.Load(path.Join(testDir, "config_err_pools.yaml"), "")
+	require.Equal(t, fmt.Errorf("pools can be defined only in the global config"), err)
+
+	for _, defs := range [][]*poolDef{
+		{{Name: "", Size: 1}},
+		{{Name: "db", Size: 0}},
+		{{Name: "db", Size: 1}, {Name: "db", Size: 2}},
+		{{Name: "../db", Size: 1}},
+		{{Name: "a/b", Size: 1}},
+		{{Name: "..", Size: 1}},
+	} {
+		_, err := buildPoolsFromDefinition(defs)
+		require.Error(t, err)
+	}
+}
+
+func TestOverlapPolicy(t *testing.T) {
+	l := &Loader{
+		HomeDir: utils.MustGetUserHomeDir(),
+	}
+
+	cfg, err := l.Load(path.Join(testDir, "config_overlap.yaml"), "")
+	require.NoError(t, err)
+	require.Equal(t, OverlapQueue, cfg.OverlapPolicy)
+
+	cfg, err = l.LoadHeadOnly(path.Join(testDir, "config_overlap.yaml"))
+	require.NoError(t, err)
+	require.Equal(t, OverlapQueue, cfg.OverlapPolicy)
+
+	cfg, err = l.Load(path.Join(testDir, "config_default.yaml"), "")
+	require.NoError(t, err)
+	require.Equal(t, OverlapSkip, cfg.OverlapPolicy)
+}
+
+func TestConfigSecrets(t *testing.T) {
+	l := &Loader{
+		HomeDir: utils.MustGetUserHomeDir(),
+	}
+	os.Setenv("CONFIG_SECRET_PASSWORD", "secret-password")
+	defer os.Unsetenv("CONFIG_SECRET_PASSWORD")
+
+	cfg, err := l.Load(path.Join(testDir, "config_secrets.yaml"), "")
+	require.NoError(t, err)
+
+	require.Equal(t, []string{"CONFIG_SECRET_PASSWORD", "TOKEN"}, cfg.Secrets)
+	require.Contains(t, cfg.Env, "NORMAL=value")
+	require.NotContains(t, cfg.Env, "TOKEN=secret-token")
+	// the variables referring to the secrets keep the references
+	// to be expanded when the steps run
+	require.Contains(t, cfg.Env, "URL=https://u:${secret:TOKEN}@host")
+	require.Contains(t, cfg.Env, "PASSWORD_URL=https://u:${secret:CONFIG_SECRET_PASSWORD}@host")
+	require.Equal(t, []string{"${TOKEN}", "${secret:CONFIG_SECRET_PASSWORD}", "value"},
+		cfg.Steps[0].Args)
+	require.Equal(t, []string{
+		"CONFIG_SECRET_PASSWORD=secret-password",
+		"TOKEN=secret-token",
+	}, cfg.Steps[0].Secrets)
+	require.NotEqual(t, "secret-token", os.Getenv("TOKEN"))
+
+	b, err := json.Marshal(cfg)
+	require.NoError(t, err)
+	require.NotContains(t, string(b), "secret-token")
+	require.NotContains(t, string(b), "secret-password")
+
+	require.Equal(t, "token=*** ***d",
+		Redact("token=secret-token secret-passwordd", cfg.Steps[0].Secrets))
+}
+
+func TestConfigOrderedEnv(t *testing.T) {
+	l := &Loader{
+		HomeDir: utils.MustGetUserHomeDir(),
+	}
+	cfg, err := l.Load(path.Join(testDir, "config_env_ordered.yaml"), "")
+	require.NoError(t, err)
+
+	require.Equal(t, append(append([]string{}, testEnv...),
+		"ORDERED_A=a2",
+		"ORDERED_B=a/b",
+		"ORDERED_C=a/b/c",
+	), cfg.Env)
+	require.Equal(t, []string{"a/b/c", "a2"}, cfg.Steps[0].Args)
+
+	// the environment of the process is not modified
+	_, ok := os.LookupEnv("ORDERED_A")
+	require.False(t, ok)
+}
+
+func TestConfigStepEnv(t *testing.T) {
+	os.Setenv("HTTP_PROXY", "proxy")
+	os.Setenv("NO_PROXY", "local")
+	os.Setenv("INHERIT_ENV_OTHER", "other")
+	defer func() {
+		os.Unsetenv("HTTP_PROXY")
+		os.Unsetenv("NO_PROXY")
+		os.Unsetenv("INHERIT_ENV_OTHER")
+	}()
+	l := &Loader{
+		HomeDir: utils.MustGetUserHomeDir(),
+	}
+	cfg, err := l.Load(path.Join(testDir, "config_step_env.yaml"), "")
+	require.NoError(t, err)
+
+	s1, s2 := cfg.Steps[0], cfg.Steps[1]
+	require.Equal(t, append(append([]string{}, testEnv...),
+		"STEP_ENV_A=a",
+		"STEP_ENV_B=a/b2",
+		"STEP_ENV_C=a/b2/c",
+	), s1.Variables)
+	require.Equal(t, []string{"a/b2/c"}, s1.Args)
+	require.Contains(t, s2.Variables, "STEP_ENV_B=b")
+	require.NotContains(t, s2.Variables, "STEP_ENV_C=a/b2/c")
+	require.Equal(t, []string{"b"}, s2.Args)
+	require.NotContains(t, cfg.Env, "STEP_ENV_C=a/b2/c")
+
+	want := &InheritEnv{
+		Allow: []string{"HOME", "*_PROXY"},
+		Deny:  []string{"NO_PROXY"},
+	}
+	require.Equal(t, want, cfg.InheritEnv)
+	require.Equal(t, want, s1.InheritEnv)
+
+	// the variables of the process not inherited are not expanded
+	// in the commands either
+	require.Equal(t, []string{"proxy", "", ""}, cfg.Steps[2].Args)
+}
+
+func TestInheritEnv(t *testing.T) {
+	environ := []string{"HOME=/home", "HTTP_PROXY=proxy", "NO_PROXY=local", "USER=user"}
+	for _, test := range []struct {
+		Value interface{}
+		Want  []string
+	}{
+		{nil, nil},
+		{true, environ},
+		{false, nil},
+		{
+			map[interface{}]interface{}{"allow": []interface{}{"HOME", "*_PROXY"}},
+			[]string{"HOME=/home", "HTTP_PROXY=proxy", "NO_PROXY=local"},
+		},
+		{
+			map[interface{}]interface{}{"deny": []interface{}{"*_PROXY"}},
+			[]string{"HOME=/home", "USER=user"},
+		},
+	} {
+		e, err := buildInheritEnv(test.Value)
+		require.NoError(t, err)
+		require.Equal(t, test.Want, e.Filter(environ))
+	}
+
+	for _, v := range []interface{}{
+		"HOME",
+		map[interface{}]interface{}{"except": []interface{}{"HOME"}},
+		map[interface{}]interface{}{"allow": []interface{}{"[HOME"}},
+	} {
+		_, err := buildInheritEnv(v)
+		require.Error(t, err)
+	}
+}
+
+func TestSignalOnStop(t *testing.T) {
+	for _, name := range []string{"SIGINT", "int", " Sigint "} {
+		sig, ok := SignalByName(name)
+		require.True(t, ok)
+		require.Equal(t, syscall.SIGINT, sig)
+		require.Equal(t, "SIGINT", normalizeSignal(name))
+	}
+	_, ok := SignalByName("SIGFOO")
+	require.False(t, ok)
+
+	l := &Loader{
+		HomeDir: utils.MustGetUserHomeDir(),
+	}
+	cfg, err := l.Load(path.Join(testDir, "agent_stop_grace.yaml"), "")
+	require.NoError(t, err)
+	require.Equal(t, "", cfg.Steps[0].SignalOnStop)
+	require.Equal(t, "SIGINT", cfg.Steps[1].SignalOnStop)
+}
+
+func TestParseEnv(t *testing.T) {
+	vars, err := parseEnv(map[interface{}]interface{}{"B": "1", "A": 2, "C": nil})
+	require.NoError(t, err)
+	require.Equal(t, []*envVar{
+		{key: "A", value: "2"},
+		{key: "B", value: "1"},
+		{key: "C", value: ""},
+	}, vars)
+
+	for _, v := range []interface{}{
+		"A=1",
+		[]interface{}{"A"},
+		[]interface{}{1},
+		[]interface{}{"=1"},
+	} {
+		_, err := parseEnv(v)
+		require.Error(t, err)
+	}
+}
+
+func TestConfigDotenv(t *testing.T) {
+	l := &Loader{
+		HomeDir: utils.MustGetUserHomeDir(),
+	}
+	file := path.Join(testDir, "config_dotenv.yaml")
+
+	os.Setenv(settings.SecretsKeyEnv, "test-key")
+	defer os.Unsetenv(settings.SecretsKeyEnv)
+	cfg, err := l.Load(file, "")
+	require.NoError(t, err)
+
+	for _, e := range []string{
+		"DOTENV_A=a",
+		"DOTENV_B=b2",
+		"DOTENV_C=c2",
+		"DOTENV_D=ad",
+	} {
+		require.Contains(t, cfg.Env, e)
+	}
+	require.Equal(t, []string{"DOTENV_PASSWORD"}, cfg.Secrets)
+	require.Equal(t, []string{"DOTENV_PASSWORD=dotenv-password"}, cfg.Steps[0].Secrets)
+	require.Equal(t, []string{"${DOTENV_PASSWORD}"}, cfg.Steps[0].Args)
+
+	os.Setenv(settings.SecretsKeyEnv, "wrong-key")
+	_, err = l.Load(file, "")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "wrong key")
+}
+
+func TestSecretsFile(t *testing.T) {
+	data := []byte("A=1\nB=2\n")
+	enc, err := EncryptSecrets(data, "key")
+	require.NoError(t, err)
+	require.NotContains(t, string(enc), "A=1")
+
+	dec, err := DecryptSecrets(enc, "key")
+	require.NoError(t, err)
+	require.Equal(t, data, dec)
+
+	_, err = DecryptSecrets(enc, "other")
+	require.Error(t, err)
+	_, err = DecryptSecrets(data, "key")
+	require.Error(t, err)
+
+	// the key is derived with a random salt written in the header
+	enc2, err := EncryptSecrets(data, "key")
+	require.NoError(t, err)
+	header := strings.SplitN(string(enc), "\n", 2)[0]
+	require.True(t, strings.HasPrefix(header, "dagu-secrets:v2 scrypt 32768 8 1 "))
+	require.NotEqual(t, header, strings.SplitN(string(enc2), "\n", 2)[0])
+
+	// the parameters in the header can not be altered
+	for _, h := range []string{
+		strings.Replace(header, " 1 ", " 2 ", 1),
+		"dagu-secrets:v2 scrypt 1073741824 8 1 AAAA",
+		"dagu-secrets:v1",
+	} {
+		_, err = DecryptSecrets([]byte(strings.Replace(string(enc), header, h, 1)), "key")
+		require.Error(t, err, h)
+	}
+
+	// the key is read from the key file when the env is not set
+	keyFile := settings.MustGet(settings.ConfigSecretsKeyFile)
+	require.NoError(t, os.MkdirAll(path.Dir(keyFile), 0755))
+	require.NoError(t, os.WriteFile(keyFile, []byte("file-key\n"), 0600))
+	defer os.Remove(keyFile)
+	key, err := SecretsKey()
+	require.NoError(t, err)
+	require.Equal(t, "file-key", key)
+}
+
+func TestConfigNamedParams(t *testing.T) {
+	l := &Loader{
+		HomeDir: utils.MustGetUserHomeDir(),
+	}
+	file := path.Join(testDir, "config_named_params.yaml")
+
+	cfg, err := l.Load(file, "")
+	require.NoError(t, err)
+	require.Equal(t, []*Param{
+		{Name: "COUNT", Type: ParamTypeInteger, Default: "10"},
+		{Name: "DATE", Type: ParamTypeDate, Required: true, Description: "target date"},
+		{Name: "LABEL", Type: ParamTypeString, Default: "hello world"},
+		{Name: "MODE", Type: ParamTypeString, Default: "full", Enum: []string{"full", "diff"}},
+	}, cfg.NamedParams)
+	require.Equal(t, `COUNT=10 "LABEL=hello world" MODE=full`, cfg.DefaultParams)
+	require.Error(t, cfg.ValidateParams())
+
+	cfg, err = l.Load(file, `DATE=2022-01-01 MODE=diff "LABEL=a b"`)
+	require.NoError(t, err)
+	require.NoError(t, cfg.ValidateParams())
+	require.Equal(t, []string{
+		"COUNT=10", "DATE=2022-01-01", "LABEL=a b", "MODE=diff",
+	}, cfg.Params)
+	require.Equal(t, []string{"2022-01-01", "diff", "10"}, cfg.Steps[0].Args)
+	require.Contains(t, cfg.Steps[1].Variables, "LABEL=a b")
+	_, ok := os.LookupEnv("DATE")
+	require.False(t, ok)
+
+	// the values are not parsed as a part of the command
+	cfg, err = l.Load(file, `DATE=2022-01-01 "LABEL=it's a&b; c"`)
+	require.NoError(t, err)
+	require.Equal(t, "echo", cfg.Steps[2].Command)
+	require.Equal(t, []string{"it's a&b; c"}, cfg.Steps[2].Args)
+
+	for _, p := range []string{
+		"DATE=2022-13-01",
+		"DATE=2022-01-01 MODE=none",
+		"DATE=2022-01-01 COUNT=1.5",
+		"DATE=2022-01-01 UNKNOWN=1",
+		"2022-01-01",
+	} {
+		_, err = l.Load(file, p)
+		require.Error(t, err, p)
+	}
+}
+
+func TestRetryPolicy(t *testing.T) {
+	p := &RetryPolicy{
+		Limit:       5,
+		Interval:    time.Second,
+		Backoff:     2,
+		MaxInterval: time.Second * 5,
+	}
+	require.Equal(t, time.Second, p.IntervalFor(1))
+	require.Equal(t, time.Second*2, p.IntervalFor(2))
+	require.Equal(t, time.Second*4, p.IntervalFor(3))
+	require.Equal(t, time.Second*5, p.IntervalFor(4))
+
+	p.Backoff = 0
+	require.Equal(t, time.Second, p.IntervalFor(3))
+
+	require.True(t, p.Retryable(1))
+	p.ExitCodes = []int{2, 3}
+	require.False(t, p.Retryable(1))
+	require.True(t, p.Retryable(3))
+}
+
 func TestLoadInvalidConfigError(t *testing.T) {
 	for _, c := range []string{
 		`env: 
   VAR: "` + "`ech 1`" + `"
 `,
 		`logDir: "` + "`ech foo`" + `"`,
+		`env: [VAR]`,
+		`steps:
+  - name: "1"
+    command: "true"
+    signalOnStop: SIGFOO
+`,
+		`inheritEnv: all`,
+		`secrets: [TOKEN]
+steps:
+  - name: "1"
+    command: "true"
+    env:
+      TOKEN: token
+`,
+		`steps:
+  - name: "1"
+    command: "true"
+    env:
+      VAR: "` + "`ech 1`" + `"
+`,
 		`params: "` + "`ech foo`" + `"`,
+		`steps:
+  - name: "1"
+    command: "true"
+    run: sub.yaml
+`,
+		`schedule: "1"`,
+		`schedule: 1`,
+		`params:
+  A:
+    type: unknown
+`,
+		`params:
+  A:
+    enum: [a]
+    unknown: 1
+`,
+		`params:
+  A-B: 1
+`,
+		`params:
+  A:
+    type: integer
+    enum: [a]
+`,
+		`params: [a, b]`,
+		`steps:
+  - name: "1"
+    command: "true"
+    retryPolicy:
+      backoff: 0.5
+`,
+		`steps:
+  - name: "1"
+    command: "true"
+    timeoutSec: -1
+`,
+		`steps:
+  - name: "1"
+    command: "true"
+    script: "true"
+`,
+		`steps:
+  - name: "1"
+    command: "true"
+    maxParallel: 2
+`,
+		`steps:
+  - name: "1"
+    command: "true"
+    weight: -1
+`,
+		`overlapPolicy: replace`,
+		`steps:
+  - name: "1"
+    command: "true"
+    foreach: []
+`,
+		`steps:
+  - name: "1"
+    command: "true"
+    foreach:
+      a: b
+`,
+		`steps:
+  - name: "1"
+    command: "true"
+    foreach: [a]
+    output: OUT
+`,
 	} {
 		l := &Loader{
 			HomeDir: utils.MustGetUserHomeDir(),
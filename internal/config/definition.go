@@ -3,8 +3,9 @@ package config
 type configDefinition struct {
 	Name              string
 	Description       string
+	Schedule          interface{}
 	LogDir            string
-	Env               map[string]string
+	Env               interface{}
 	HandlerOn         handlerOnDef
 	Steps             []*stepDef
 	Smtp              smtpConfigDef
@@ -15,13 +16,32 @@ type configDefinition struct {
 	HistRetentionDays *int
 	Preconditions     []*conditionDef
 	MaxActiveRuns     int
-	Params            string
+	Params            interface{}
 	MaxCleanUpTimeSec *int
+	TimeoutSec        int
+	Shell             string
+	Secrets           []string
+	Dotenv            interface{}
+	SecretsFile       string
+	InheritEnv        interface{}
+	Pools             []*poolDef
+	OverlapPolicy     string
+}
+
+type paramDef struct {
+	Type        string
+	Default     interface{}
+	Required    bool
+	Enum        []interface{}
+	Description string
 }
 
 type conditionDef struct {
-	Condition string
-	Expected  string
+	Condition  string
+	Expected   string
+	Operator   string
+	Command    string
+	FileExists string
 }
 
 type handlerOnDef struct {
@@ -36,12 +56,25 @@ type stepDef struct {
 	Description   string
 	Dir           string
 	Command       string
+	Script        string
+	Shell         string
+	Run           string
+	Params        string
+	Output        string
 	Depends       []string
 	ContinueOn    *continueOnDef
 	RetryPolicy   *retryPolicyDef
 	RepeatPolicy  *repeatPolicyDef
 	MailOnError   bool
 	Preconditions []*conditionDef
+	TimeoutSec    int
+	Foreach       interface{}
+	MaxParallel   int
+	Env           interface{}
+	SignalOnStop  string
+	Priority      int
+	Weight        int
+	Pool          string
 }
 
 type continueOnDef struct {
@@ -55,7 +88,16 @@ type repeatPolicyDef struct {
 }
 
 type retryPolicyDef struct {
-	Limit int
+	Limit          int
+	IntervalSec    int
+	Backoff        float64
+	MaxIntervalSec int
+	ExitCodes      []int
+}
+
+type poolDef struct {
+	Name string
+	Size int
 }
 
 type smtpConfigDef struct {
@@ -0,0 +1,186 @@
+package config
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/joho/godotenv"
+	"github.com/yohamta/dagu/internal/settings"
+	"golang.org/x/crypto/scrypt"
+)
+
+// loadDotenv reads the variables from the dotenv files. The variables
+// in the later files take precedence over the ones in the former.
+func loadDotenv(files []string) (map[string]string, error) {
+	ret := map[string]string{}
+	for _, file := range files {
+		vars, err := godotenv.Read(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read dotenv file %s: %w", file, err)
+		}
+		for k, v := range vars {
+			ret[k] = v
+		}
+	}
+	return ret, nil
+}
+
+// secretsFileVersion begins the first line of the encrypted secrets
+// file, which is followed by the parameters of the key derivation:
+//
+//	dagu-secrets:v2 scrypt <N> <r> <p> <base64 salt>
+const secretsFileVersion = "dagu-secrets:v2"
+
+// kdfParams are the parameters of scrypt to derive the key
+// of AES-256 from the secrets key.
+type kdfParams struct {
+	N, r, p int
+	salt    []byte
+}
+
+// defaultKDFParams are the parameters for the new secrets files,
+// recommended for interactive use in the scrypt paper.
+var defaultKDFParams = kdfParams{N: 1 << 15, r: 8, p: 1}
+
+// maxKDFCost limits N*r of the secrets files to read so that
+// a crafted file can not make the key derivation take too long.
+const maxKDFCost = 1 << 23
+
+func (k *kdfParams) header() string {
+	return fmt.Sprintf("%s scrypt %d %d %d %s", secretsFileVersion,
+		k.N, k.r, k.p, base64.StdEncoding.EncodeToString(k.salt))
+}
+
+func parseKDFParams(header string) (*kdfParams, error) {
+	fields := strings.Fields(header)
+	if len(fields) == 0 || fields[0] != secretsFileVersion {
+		return nil, fmt.Errorf("not an encrypted secrets file")
+	}
+	if len(fields) != 6 || fields[1] != "scrypt" {
+		return nil, fmt.Errorf("invalid secrets file header")
+	}
+	k := &kdfParams{}
+	if _, err := fmt.Sscanf(strings.Join(fields[2:5], " "), "%d %d %d", &k.N, &k.r, &k.p); err != nil {
+		return nil, fmt.Errorf("invalid secrets file header: %w", err)
+	}
+	if k.N <= 1 || k.r <= 0 || k.p <= 0 || k.N > maxKDFCost/k.r || k.p > 16 {
+		return nil, fmt.Errorf("invalid parameters in the secrets file header")
+	}
+	salt, err := base64.StdEncoding.DecodeString(fields[5])
+	if err != nil {
+		return nil, fmt.Errorf("invalid salt in the secrets file header: %w", err)
+	}
+	k.salt = salt
+	return k, nil
+}
+
+// SecretsKey returns the key to decrypt the secrets files. It is taken
+// from the environment variable if set, and from the key file otherwise.
+func SecretsKey() (string, error) {
+	if key := os.Getenv(settings.SecretsKeyEnv); key != "" {
+		return key, nil
+	}
+	file := settings.MustGet(settings.ConfigSecretsKeyFile)
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return "", fmt.Errorf("secrets key is not given by %s or %s: %w",
+			settings.SecretsKeyEnv, file, err)
+	}
+	key := strings.TrimSpace(string(b))
+	if key == "" {
+		return "", fmt.Errorf("secrets key file is empty: %s", file)
+	}
+	return key, nil
+}
+
+func secretsCipher(key string, params *kdfParams) (cipher.AEAD, error) {
+	k, err := scrypt.Key([]byte(key), params.salt, params.N, params.r, params.p, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(k)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// EncryptSecrets encrypts the secrets in the dotenv format with
+// AES-GCM using the key derived from the secrets key by scrypt with
+// a random salt. The salt and the parameters of scrypt are written
+// in the header of the file.
+func EncryptSecrets(data []byte, key string) ([]byte, error) {
+	params := defaultKDFParams
+	params.salt = make([]byte, 16)
+	if _, err := io.ReadFull(rand.Reader, params.salt); err != nil {
+		return nil, err
+	}
+	gcm, err := secretsCipher(key, &params)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	header := params.header()
+	// the header is authenticated so that its parameters can not be altered
+	sealed := gcm.Seal(nonce, nonce, data, []byte(header))
+	return []byte(fmt.Sprintf("%s\n%s\n", header,
+		base64.StdEncoding.EncodeToString(sealed))), nil
+}
+
+// DecryptSecrets decrypts the secrets encrypted by EncryptSecrets.
+func DecryptSecrets(data []byte, key string) ([]byte, error) {
+	lines := strings.SplitN(strings.TrimSpace(string(data)), "\n", 2)
+	if len(lines) != 2 {
+		return nil, fmt.Errorf("not an encrypted secrets file")
+	}
+	header := strings.TrimSpace(lines[0])
+	params, err := parseKDFParams(header)
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimSpace(lines[1]))
+	if err != nil {
+		return nil, fmt.Errorf("invalid secrets file: %w", err)
+	}
+	gcm, err := secretsCipher(key, params)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, fmt.Errorf("invalid secrets file")
+	}
+	nonce, sealed := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	ret, err := gcm.Open(nil, nonce, sealed, []byte(header))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt secrets: wrong key or corrupted file")
+	}
+	return ret, nil
+}
+
+// loadSecretsFile decrypts the secrets file and returns the
+// variables in it.
+func loadSecretsFile(file string) (map[string]string, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	key, err := SecretsKey()
+	if err != nil {
+		return nil, err
+	}
+	plain, err := DecryptSecrets(data, key)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	return godotenv.Parse(bytes.NewReader(plain))
+}
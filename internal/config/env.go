@@ -0,0 +1,253 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/mitchellh/mapstructure"
+	"github.com/yohamta/dagu/internal/utils"
+)
+
+// envVar is a variable of the env field.
+type envVar struct {
+	key   string
+	value string
+}
+
+// parseEnv reads the env field, which is a list of NAME: VALUE maps
+// or NAME=VALUE strings evaluated in order, or a map. The variables
+// in a map are evaluated in the order of their names.
+func parseEnv(v interface{}) ([]*envVar, error) {
+	var ret []*envVar
+	switch v := v.(type) {
+	case nil:
+	case map[interface{}]interface{}, map[string]interface{}, map[string]string:
+		ret = append(ret, mapEnv(v)...)
+	case []interface{}:
+		for _, e := range v {
+			switch e := e.(type) {
+			case string:
+				kv := strings.SplitN(e, "=", 2)
+				if len(kv) != 2 {
+					return nil, fmt.Errorf("env must be given as NAME=VALUE: %q", e)
+				}
+				ret = append(ret, &envVar{key: kv[0], value: kv[1]})
+			case map[interface{}]interface{}, map[string]interface{}:
+				ret = append(ret, mapEnv(e)...)
+			default:
+				return nil, fmt.Errorf("invalid env: %v", e)
+			}
+		}
+	default:
+		return nil, fmt.Errorf("env must be a list or a map")
+	}
+	for _, e := range ret {
+		if e.key == "" {
+			return nil, fmt.Errorf("env name must not be empty")
+		}
+	}
+	return ret, nil
+}
+
+func mapEnv(m interface{}) []*envVar {
+	var ret []*envVar
+	switch m := m.(type) {
+	case map[interface{}]interface{}:
+		for k, v := range m {
+			ret = append(ret, &envVar{key: fmt.Sprint(k), value: envValue(v)})
+		}
+	case map[string]interface{}:
+		for k, v := range m {
+			ret = append(ret, &envVar{key: k, value: envValue(v)})
+		}
+	case map[string]string:
+		for k, v := range m {
+			ret = append(ret, &envVar{key: k, value: v})
+		}
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].key < ret[j].key
+	})
+	return ret
+}
+
+func envValue(v interface{}) string {
+	if v == nil {
+		return ""
+	}
+	return fmt.Sprint(v)
+}
+
+// envList converts the variables to the list form of the env field.
+func envList(vars []*envVar) []interface{} {
+	var ret []interface{}
+	for _, e := range vars {
+		ret = append(ret, map[interface{}]interface{}{e.key: e.value})
+	}
+	return ret
+}
+
+// envScope holds the variables evaluated while loading a DAG.
+// They are looked up before the environment of the process, which
+// is never modified so that DAGs loaded in the same process do not
+// affect each other. The references to the secrets are kept as
+// ${secret:NAME} to be expanded when the steps run.
+type envScope struct {
+	keys    []string
+	vars    map[string]string
+	secrets map[string]bool
+}
+
+func newEnvScope() *envScope {
+	return &envScope{vars: map[string]string{}}
+}
+
+// clone returns a copy of the scope to evaluate
+// the variables of a step in.
+func (s *envScope) clone() *envScope {
+	ret := newEnvScope()
+	for _, k := range s.keys {
+		ret.set(k, s.vars[k])
+	}
+	ret.secrets = s.secrets
+	return ret
+}
+
+func (s *envScope) set(key, value string) {
+	if _, ok := s.vars[key]; !ok {
+		s.keys = append(s.keys, key)
+	}
+	s.vars[key] = value
+}
+
+func (s *envScope) has(key string) bool {
+	_, ok := s.vars[key]
+	return ok
+}
+
+func (s *envScope) get(key string) string {
+	if v, ok := s.vars[key]; ok {
+		return v
+	}
+	return os.Getenv(key)
+}
+
+// variables returns the variables as NAME=VALUE in the order
+// they are defined first.
+func (s *envScope) variables() []string {
+	var ret []string
+	for _, k := range s.keys {
+		ret = append(ret, fmt.Sprintf("%s=%s", k, s.vars[k]))
+	}
+	return ret
+}
+
+// overrideVariables returns the variables given as NAME=VALUE with
+// the values replaced by the ones of vars and the rest of vars added.
+func overrideVariables(variables []string, vars []*envVar, values map[string]string) []string {
+	ret := make([]string, 0, len(variables)+len(vars))
+	overridden := map[string]bool{}
+	for _, v := range variables {
+		key := strings.SplitN(v, "=", 2)[0]
+		if val, ok := values[key]; ok && !overridden[key] {
+			v = fmt.Sprintf("%s=%s", key, val)
+			overridden[key] = true
+		}
+		ret = append(ret, v)
+	}
+	for _, e := range vars {
+		if !overridden[e.key] {
+			ret = append(ret, fmt.Sprintf("%s=%s", e.key, values[e.key]))
+			overridden[e.key] = true
+		}
+	}
+	return ret
+}
+
+// parse expands the variables and runs the command substitutions
+// in the value.
+func (s *envScope) parse(value string) (string, error) {
+	return utils.ParseVariableWith(value, s.variables(), func(v string) string {
+		return os.Expand(v, func(k string) string {
+			name := strings.TrimPrefix(k, SecretRefPrefix)
+			if s.secrets[name] || name != k {
+				return fmt.Sprintf("${%s%s}", SecretRefPrefix, name)
+			}
+			return s.get(k)
+		})
+	})
+}
+
+// InheritEnv selects the variables of the environment of the dagu
+// process to pass to the steps. The names are matched against the
+// glob patterns of Allow and Deny. All the variables are allowed
+// when Allow is empty, and Deny takes precedence over Allow.
+type InheritEnv struct {
+	Allow []string
+	Deny  []string
+}
+
+// buildInheritEnv reads the inheritEnv field, which is a boolean or
+// a map of the allow and deny lists. It returns nil when the field
+// is not set.
+func buildInheritEnv(v interface{}) (*InheritEnv, error) {
+	switch v := v.(type) {
+	case nil:
+		return nil, nil
+	case bool:
+		if !v {
+			// not nil to override the global config
+			return &InheritEnv{Deny: []string{"*"}}, nil
+		}
+		return &InheritEnv{}, nil
+	case map[interface{}]interface{}, map[string]interface{}:
+		ret := &InheritEnv{}
+		md, _ := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+			ErrorUnused: true,
+			Result:      ret,
+		})
+		if err := md.Decode(v); err != nil {
+			return nil, fmt.Errorf("inheritEnv: %w", err)
+		}
+		for _, p := range append(append([]string{}, ret.Allow...), ret.Deny...) {
+			if _, err := path.Match(p, ""); err != nil {
+				return nil, fmt.Errorf("inheritEnv: invalid pattern %q", p)
+			}
+		}
+		return ret, nil
+	}
+	return nil, fmt.Errorf("inheritEnv must be a boolean or a map of allow and deny")
+}
+
+// Filter returns the variables given as NAME=VALUE to inherit.
+func (e *InheritEnv) Filter(environ []string) []string {
+	if e == nil {
+		return nil
+	}
+	var ret []string
+	for _, v := range environ {
+		if e.allows(strings.SplitN(v, "=", 2)[0]) {
+			ret = append(ret, v)
+		}
+	}
+	return ret
+}
+
+func (e *InheritEnv) allows(name string) bool {
+	if len(e.Allow) > 0 && !matchAny(e.Allow, name) {
+		return false
+	}
+	return !matchAny(e.Deny, name)
+}
+
+func matchAny(patterns []string, name string) bool {
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, name); ok {
+			return true
+		}
+	}
+	return false
+}
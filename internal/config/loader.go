@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"io/ioutil"
+	"os"
 	"path"
 	"path/filepath"
 
@@ -44,14 +45,20 @@ func (cl *Loader) loadGlobalConfig(file string) (*Config, error) {
 		return nil, err
 	}
 
-	if def.Env == nil {
-		def.Env = map[string]string{}
+	vars, err := parseEnv(def.Env)
+	if err != nil {
+		return nil, err
+	}
+	defined := map[string]bool{}
+	for _, e := range vars {
+		defined[e.key] = true
 	}
 	for k, v := range utils.DefaultEnv() {
-		if _, ok := def.Env[v]; !ok {
-			def.Env[k] = v
+		if !defined[k] {
+			vars = append([]*envVar{{key: k, value: v}}, vars...)
 		}
 	}
+	def.Env = envList(vars)
 
 	return buildFromDefinition(
 		def, nil, &BuildConfigOptions{headOnly: false},
@@ -110,6 +117,12 @@ func (cl *Loader) loadConfig(f, params string, headOnly bool) (*Config, error) {
 		return nil, err
 	}
 
+	if !headOnly {
+		if err := dst.assertPools(); err != nil {
+			return nil, err
+		}
+	}
+
 	dst.setup(file)
 
 	return dst, nil
@@ -120,7 +133,201 @@ func (cl *Loader) merge(dst, src *Config) error {
 }
 
 func (cl *Loader) load(file string) (config map[string]interface{}, err error) {
-	return cl.readFile(file)
+	return cl.resolve(file, map[string]bool{})
+}
+
+// ReadResolved returns the definition of the DAG in YAML
+// with extends and include resolved.
+func (cl *Loader) ReadResolved(file string) (string, error) {
+	file, err := filepath.Abs(file)
+	if err != nil {
+		return "", err
+	}
+	raw, err := cl.load(file)
+	if err != nil {
+		return "", err
+	}
+	b, err := yaml.Marshal(raw)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+const (
+	keyExtends     = "extends"
+	keyInclude     = "include"
+	keySteps       = "steps"
+	keyEnv         = "env"
+	keyDotenv      = "dotenv"
+	keySecretsFile = "secretsFile"
+)
+
+// resolve reads the file and resolves extends and include.
+// The steps of the included files are added before the steps of
+// the file in the order of the list. Then the file is merged into
+// the file it extends: maps are merged recursively, and the other
+// values including lists are replaced by the values of the file,
+// except env whose variables are added after the ones of the base.
+// Relative paths are resolved against the directory of the file.
+func (cl *Loader) resolve(file string, visited map[string]bool) (map[string]interface{}, error) {
+	if visited[file] {
+		return nil, fmt.Errorf("circular extends: %s", file)
+	}
+	visited[file] = true
+
+	raw, err := cl.readFile(file)
+	if err != nil {
+		return nil, err
+	}
+	if raw == nil {
+		raw = map[string]interface{}{}
+	}
+	dir := filepath.Dir(file)
+
+	if v, ok := raw[keyDotenv]; ok {
+		files, err := toStringList(v)
+		if err != nil {
+			return nil, fmt.Errorf("%s: dotenv: %w", file, err)
+		}
+		var resolved []interface{}
+		for _, f := range files {
+			resolved = append(resolved, resolvePath(dir, f))
+		}
+		raw[keyDotenv] = resolved
+	}
+	if v, ok := raw[keySecretsFile].(string); ok && v != "" {
+		raw[keySecretsFile] = resolvePath(dir, v)
+	}
+
+	if v, ok := raw[keyInclude]; ok {
+		delete(raw, keyInclude)
+		includes, err := toStringList(v)
+		if err != nil {
+			return nil, fmt.Errorf("%s: include: %w", file, err)
+		}
+		var steps []interface{}
+		for _, inc := range includes {
+			s, err := cl.readSteps(resolvePath(dir, inc))
+			if err != nil {
+				return nil, err
+			}
+			steps = append(steps, s...)
+		}
+		if own, ok := raw[keySteps]; ok && own != nil {
+			s, ok := own.([]interface{})
+			if !ok {
+				return nil, fmt.Errorf("%s: steps must be a list", file)
+			}
+			steps = append(steps, s...)
+		}
+		raw[keySteps] = steps
+	}
+
+	if v, ok := raw[keyExtends]; ok {
+		delete(raw, keyExtends)
+		base, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("%s: extends must be a file path", file)
+		}
+		baseRaw, err := cl.resolve(resolvePath(dir, base), visited)
+		if err != nil {
+			return nil, err
+		}
+		if v, ok := raw[keyEnv]; ok {
+			env, err := mergeEnv(baseRaw[keyEnv], v)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", file, err)
+			}
+			raw[keyEnv] = env
+		}
+		for k, v := range raw {
+			baseRaw[k] = mergeValue(baseRaw[k], v)
+		}
+		raw = baseRaw
+	}
+	return raw, nil
+}
+
+// readSteps reads the steps from the included file,
+// which can only have the steps field.
+func (cl *Loader) readSteps(file string) ([]interface{}, error) {
+	raw, err := cl.readFile(file)
+	if err != nil {
+		return nil, err
+	}
+	for k := range raw {
+		if k != keySteps {
+			return nil, fmt.Errorf("%s: only steps can be included: %s", file, k)
+		}
+	}
+	steps, ok := raw[keySteps].([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s: steps must be a list", file)
+	}
+	return steps, nil
+}
+
+// mergeEnv concatenates the variables of the env fields so that
+// the variables of the file can refer to and override the ones of
+// the base in order.
+func mergeEnv(base, v interface{}) ([]interface{}, error) {
+	baseVars, err := parseEnv(base)
+	if err != nil {
+		return nil, err
+	}
+	vars, err := parseEnv(v)
+	if err != nil {
+		return nil, err
+	}
+	return envList(append(baseVars, vars...)), nil
+}
+
+func mergeValue(base, v interface{}) interface{} {
+	bm, ok := base.(map[interface{}]interface{})
+	if !ok {
+		return v
+	}
+	vm, ok := v.(map[interface{}]interface{})
+	if !ok {
+		return v
+	}
+	ret := map[interface{}]interface{}{}
+	for k, x := range bm {
+		ret[k] = x
+	}
+	for k, x := range vm {
+		ret[k] = mergeValue(ret[k], x)
+	}
+	return ret
+}
+
+func toStringList(v interface{}) ([]string, error) {
+	switch v := v.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return []string{v}, nil
+	case []interface{}:
+		var ret []string
+		for _, e := range v {
+			s, ok := e.(string)
+			if !ok {
+				return nil, fmt.Errorf("invalid value %v", e)
+			}
+			ret = append(ret, s)
+		}
+		return ret, nil
+	}
+	return nil, fmt.Errorf("invalid value %v", v)
+}
+
+func resolvePath(dir, file string) string {
+	file = os.ExpandEnv(file)
+	if filepath.IsAbs(file) {
+		return file
+	}
+	return filepath.Join(dir, file)
 }
 
 func (cl *Loader) readFile(file string) (config map[string]interface{}, err error) {
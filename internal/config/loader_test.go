@@ -3,8 +3,6 @@ package config
 import (
 	"fmt"
 	"path"
-	"sort"
-	"strings"
 	"testing"
 	"time"
 
@@ -40,12 +38,17 @@ func TestLoadConfig(t *testing.T) {
 				Skipped: true,
 			},
 			RetryPolicy: &RetryPolicy{
-				Limit: 2,
+				Limit:       2,
+				Interval:    time.Second * 5,
+				Backoff:     2,
+				MaxInterval: time.Second * 60,
+				ExitCodes:   []int{1, 2},
 			},
 			RepeatPolicy: RepeatPolicy{
 				Repeat:   true,
 				Interval: time.Second * 10,
 			},
+			Timeout: time.Second * 60,
 		},
 		{
 			Name:      "2",
@@ -127,6 +130,9 @@ func TestLoadConfig(t *testing.T) {
 			Cancel:  stepm[constants.OnCancel],
 		},
 		MaxCleanUpTime: time.Second * 500,
+		Timeout:        time.Hour,
+		Pools:          []*PoolConfig{{Name: "db", Size: 2}},
+		OverlapPolicy:  OverlapSkip,
 	}
 	assert.Equal(t, want, cfg)
 }
@@ -141,10 +147,6 @@ func TestLoadGlobalConfig(t *testing.T) {
 	require.NotNil(t, cfg)
 	require.NoError(t, err)
 
-	sort.Slice(cfg.Env, func(i, j int) bool {
-		return strings.Compare(cfg.Env[i], cfg.Env[j]) < 0
-	})
-
 	want := &Config{
 		Env:               testEnv,
 		LogDir:            path.Join(testHomeDir, "/logs"),
@@ -166,6 +168,7 @@ func TestLoadGlobalConfig(t *testing.T) {
 			Prefix: "[INFO]",
 		},
 		Preconditions: nil,
+		Pools:         []*PoolConfig{{Name: "db", Size: 2}},
 	}
 	assert.Equal(t, want, cfg)
 }
@@ -207,3 +210,48 @@ func TestDecodeError(t *testing.T) {
 	_, err := l.Load(file, "")
 	require.Error(t, err)
 }
+
+func TestLoadExtends(t *testing.T) {
+	l := &Loader{
+		HomeDir: utils.MustGetUserHomeDir(),
+	}
+	cfg, err := l.Load(path.Join(testDir, "config_extends.yaml"), "")
+	require.NoError(t, err)
+
+	require.Equal(t, "child", cfg.Name)
+	require.Equal(t, 7, cfg.HistRetentionDays)
+	require.Equal(t, 3, cfg.MaxActiveRuns)
+	require.Equal(t, "smtp.child", cfg.Smtp.Host)
+	require.Equal(t, "25", cfg.Smtp.Port)
+
+	// the steps of the child replace the steps of the base,
+	// and the included steps come before its own steps.
+	require.Len(t, cfg.Steps, 2)
+	require.Equal(t, "included step", cfg.Steps[0].Name)
+	require.Equal(t, "own step", cfg.Steps[1].Name)
+
+	// the env of the child is added after the env of the base
+	require.Contains(t, cfg.Env, "BASE_DIR=/base")
+	require.Contains(t, cfg.Env, "WORK_DIR=/base/work")
+
+	resolved, err := l.ReadResolved(path.Join(testDir, "config_extends.yaml"))
+	require.NoError(t, err)
+	require.Contains(t, resolved, "host: smtp.child")
+	require.Contains(t, resolved, "histRetentionDays: 7")
+	require.NotContains(t, resolved, "extends:")
+	require.NotContains(t, resolved, "include:")
+}
+
+func TestLoadExtendsError(t *testing.T) {
+	l := &Loader{
+		HomeDir: utils.MustGetUserHomeDir(),
+	}
+	for file, msg := range map[string]string{
+		"config_err_extends_circular.yaml": "circular extends",
+		"config_err_include.yaml":          "only steps can be included",
+	} {
+		_, err := l.Load(path.Join(testDir, file), "")
+		require.Error(t, err)
+		require.Contains(t, err.Error(), msg)
+	}
+}
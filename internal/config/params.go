@@ -0,0 +1,218 @@
+package config
+
+import (
+	"encoding/csv"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mitchellh/mapstructure"
+	"github.com/yohamta/dagu/internal/utils"
+)
+
+// Param is a named parameter of the DAG.
+type Param struct {
+	Name        string
+	Type        string
+	Default     string
+	Required    bool
+	Enum        []string
+	Description string
+}
+
+const (
+	ParamTypeString  = "string"
+	ParamTypeInteger = "integer"
+	ParamTypeNumber  = "number"
+	ParamTypeBoolean = "boolean"
+	ParamTypeDate    = "date"
+)
+
+var paramTypes = map[string]bool{
+	ParamTypeString:  true,
+	ParamTypeInteger: true,
+	ParamTypeNumber:  true,
+	ParamTypeBoolean: true,
+	ParamTypeDate:    true,
+}
+
+// Validate returns an error if the value does not match
+// the type or is not one of the enum values of the parameter.
+func (p *Param) Validate(value string) error {
+	var err error
+	switch p.Type {
+	case ParamTypeInteger:
+		_, err = strconv.ParseInt(value, 10, 64)
+	case ParamTypeNumber:
+		_, err = strconv.ParseFloat(value, 64)
+	case ParamTypeBoolean:
+		_, err = strconv.ParseBool(value)
+	case ParamTypeDate:
+		_, err = time.Parse("2006-01-02", value)
+	}
+	if err != nil {
+		return fmt.Errorf("parameter %s must be %s: %q", p.Name, p.Type, value)
+	}
+	if len(p.Enum) > 0 {
+		for _, e := range p.Enum {
+			if e == value {
+				return nil
+			}
+		}
+		return fmt.Errorf("parameter %s must be one of [%s]: %q",
+			p.Name, strings.Join(p.Enum, ", "), value)
+	}
+	return nil
+}
+
+// buildNamedParams builds the named parameters from the params field
+// when it is a map. The parameters are sorted by name.
+func buildNamedParams(value interface{}) ([]*Param, error) {
+	m, ok := value.(map[interface{}]interface{})
+	if !ok {
+		return nil, fmt.Errorf("params must be a string or a map")
+	}
+	var ret []*Param
+	for k, v := range m {
+		p := &Param{Name: fmt.Sprint(k), Type: ParamTypeString}
+		if !utils.IsValidVariableName(p.Name) {
+			return nil, fmt.Errorf("invalid parameter name %q", p.Name)
+		}
+		switch v := v.(type) {
+		case nil:
+		case map[interface{}]interface{}:
+			def := &paramDef{}
+			md, _ := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+				ErrorUnused: true,
+				Result:      def,
+			})
+			if err := md.Decode(v); err != nil {
+				return nil, fmt.Errorf("parameter %s: %w", p.Name, err)
+			}
+			if def.Type != "" {
+				p.Type = def.Type
+			}
+			if def.Default != nil {
+				p.Default = fmt.Sprint(def.Default)
+			}
+			p.Required = def.Required
+			for _, e := range def.Enum {
+				p.Enum = append(p.Enum, fmt.Sprint(e))
+			}
+			p.Description = def.Description
+		default:
+			// a scalar value is the default value
+			p.Default = fmt.Sprint(v)
+		}
+		if !paramTypes[p.Type] {
+			return nil, fmt.Errorf("invalid type %q of parameter %s", p.Type, p.Name)
+		}
+		for _, e := range p.Enum {
+			if err := p.Validate(e); err != nil {
+				return nil, err
+			}
+		}
+		ret = append(ret, p)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Name < ret[j].Name
+	})
+	return ret, nil
+}
+
+// splitParameters evaluates the variables and the command substitutions
+// in the parameters in the scope and splits them by spaces. Double quotes
+// can be used for values containing spaces. The references to the secrets
+// are kept to be expanded when the steps run.
+func splitParameters(value string, env *envScope) ([]string, error) {
+	var b strings.Builder
+	last := 0
+	for _, m := range secretRef.FindAllStringIndex(value, -1) {
+		p, err := env.parse(value[last:m[0]])
+		if err != nil {
+			return nil, err
+		}
+		b.WriteString(p)
+		b.WriteString(value[m[0]:m[1]])
+		last = m[1]
+	}
+	p, err := env.parse(value[last:])
+	if err != nil {
+		return nil, err
+	}
+	b.WriteString(p)
+	params := b.String()
+	r := csv.NewReader(strings.NewReader(params))
+	r.Comma = ' '
+	records, err := r.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	var ret []string
+	for _, r := range records {
+		ret = append(ret, r...)
+	}
+	return ret, nil
+}
+
+// parseNamedParameters parses the parameters given as NAME=VALUE
+// and applies the default values of the parameters not given.
+// It returns the values of the parameters by name.
+func parseNamedParameters(value string, params []*Param, env *envScope) (map[string]string, error) {
+	declared := map[string]*Param{}
+	for _, p := range params {
+		declared[p.Name] = p
+	}
+	ret := map[string]string{}
+	vals, err := splitParameters(value, env)
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range vals {
+		kv := strings.SplitN(v, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("parameter must be given as NAME=VALUE: %q", v)
+		}
+		if _, ok := declared[kv[0]]; !ok {
+			return nil, fmt.Errorf("unknown parameter %q", kv[0])
+		}
+		ret[kv[0]] = kv[1]
+	}
+	for _, p := range params {
+		if _, ok := ret[p.Name]; ok || p.Default == "" {
+			continue
+		}
+		ret[p.Name], err = env.parse(p.Default)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for name, v := range ret {
+		if err := declared[name].Validate(v); err != nil {
+			return nil, err
+		}
+	}
+	return ret, nil
+}
+
+// ValidateParams returns an error if any of the required
+// parameters is not given.
+func (c *Config) ValidateParams() error {
+	given := map[string]bool{}
+	for _, p := range c.Params {
+		given[strings.SplitN(p, "=", 2)[0]] = true
+	}
+	var missing []string
+	for _, p := range c.NamedParams {
+		if p.Required && !given[p.Name] {
+			missing = append(missing, p.Name)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("required parameters are not given: %s",
+			strings.Join(missing, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package config
+
+import (
+	"fmt"
+
+	"github.com/yohamta/dagu/internal/utils"
+)
+
+// PoolConfig is a pool of slots shared by the DAGs on the host.
+// The steps with the pool run at most Size at once.
+type PoolConfig struct {
+	Name string
+	Size int
+}
+
+func buildPoolsFromDefinition(defs []*poolDef) ([]*PoolConfig, error) {
+	var ret []*PoolConfig
+	names := map[string]bool{}
+	for _, def := range defs {
+		if def.Name == "" {
+			return nil, fmt.Errorf("pool name must be specified")
+		}
+		// the name is used as the name of the directory of the slots
+		if def.Name == "." || def.Name == ".." || utils.ValidFilename(def.Name, "_") != def.Name {
+			return nil, fmt.Errorf("invalid pool name %q", def.Name)
+		}
+		if names[def.Name] {
+			return nil, fmt.Errorf("duplicate pool name: %s", def.Name)
+		}
+		names[def.Name] = true
+		if def.Size < 1 {
+			return nil, fmt.Errorf("pool %s: size must be greater than 0", def.Name)
+		}
+		ret = append(ret, &PoolConfig{Name: def.Name, Size: def.Size})
+	}
+	return ret, nil
+}
+
+// assertPools checks that the pools of the steps are defined.
+func (c *Config) assertPools() error {
+	defined := map[string]bool{}
+	for _, p := range c.Pools {
+		defined[p.Name] = true
+	}
+	steps := append([]*Step{}, c.Steps...)
+	steps = append(steps,
+		c.HandlerOn.Exit, c.HandlerOn.Success,
+		c.HandlerOn.Failure, c.HandlerOn.Cancel)
+	for _, s := range steps {
+		if s != nil && s.Pool != "" && !defined[s.Pool] {
+			return fmt.Errorf("step %s: pool %s is not defined", s.Name, s.Pool)
+		}
+	}
+	return nil
+}
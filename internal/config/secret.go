@@ -0,0 +1,150 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/yohamta/dagu/internal/utils"
+)
+
+// SecretRefPrefix is the prefix of the references to secrets
+// in the form of ${secret:NAME}.
+const SecretRefPrefix = "secret:"
+
+var secretRef = regexp.MustCompile(`\$\{secret:([^}]*)\}`)
+
+// secretNames returns the names of the secrets declared in the
+// definition or the global config, or referred to as ${secret:NAME}
+// in the definition or the parameters. A parent DAG passes its
+// secrets to the sub DAG as references in the parameters.
+func secretNames(def *configDefinition, params string, globalConfig *Config) (map[string]bool, error) {
+	ret := map[string]bool{}
+	for _, name := range def.Secrets {
+		ret[name] = true
+	}
+	collectSecretRefs(reflect.ValueOf(def), ret)
+	collectSecretRefs(reflect.ValueOf(params), ret)
+	for name := range ret {
+		if !utils.IsValidVariableName(name) {
+			return nil, fmt.Errorf("invalid secret name %q", name)
+		}
+	}
+	if globalConfig != nil {
+		for _, name := range globalConfig.Secrets {
+			ret[name] = true
+		}
+	}
+	return ret, nil
+}
+
+func collectSecretRefs(v reflect.Value, ret map[string]bool) {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if !v.IsNil() {
+			collectSecretRefs(v.Elem(), ret)
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			collectSecretRefs(v.Field(i), ret)
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			collectSecretRefs(v.Index(i), ret)
+		}
+	case reflect.Map:
+		for _, k := range v.MapKeys() {
+			collectSecretRefs(v.MapIndex(k), ret)
+		}
+	case reflect.String:
+		for _, m := range secretRef.FindAllStringSubmatch(v.String(), -1) {
+			ret[m[1]] = true
+		}
+	}
+}
+
+// Redacted replaces the values of secrets in logs and status.
+const Redacted = "***"
+
+// secretValue returns the value of the secret. It is taken from
+// the env of the DAG or the global config if defined, and from the
+// environment of the process otherwise.
+func secretValue(name string, env map[string]string, globalConfig *Config) string {
+	if v, ok := env[name]; ok {
+		return v
+	}
+	if globalConfig != nil {
+		if v, ok := globalConfig.SecretValues[name]; ok {
+			return v
+		}
+	}
+	return os.Getenv(name)
+}
+
+// setupSecrets sets the values of the secrets to the steps.
+// The secrets are passed to the commands as environment variables,
+// but are not kept in the fields that are saved in the status.
+func (c *Config) setupSecrets(names map[string]bool, env map[string]string, globalConfig *Config) {
+	if len(names) == 0 {
+		return
+	}
+	values := map[string]string{}
+	for name := range names {
+		c.Secrets = append(c.Secrets, name)
+		values[name] = secretValue(name, env, globalConfig)
+	}
+	// a secret defined in the env may refer to the other secrets
+	c.SecretValues = map[string]string{}
+	for name, v := range values {
+		c.SecretValues[name] = secretRef.ReplaceAllStringFunc(v, func(ref string) string {
+			return values[secretRef.FindStringSubmatch(ref)[1]]
+		})
+	}
+	sort.Strings(c.Secrets)
+	vars := c.SecretVariables()
+	steps := append([]*Step{}, c.Steps...)
+	steps = append(steps, c.HandlerOn.Exit, c.HandlerOn.Success,
+		c.HandlerOn.Failure, c.HandlerOn.Cancel)
+	for _, s := range steps {
+		if s != nil {
+			s.Secrets = vars
+		}
+	}
+}
+
+// SecretVariables returns the secrets as NAME=VALUE.
+func (c *Config) SecretVariables() []string {
+	var ret []string
+	for _, name := range c.Secrets {
+		ret = append(ret, fmt.Sprintf("%s=%s", name, c.SecretValues[name]))
+	}
+	return ret
+}
+
+// Redact replaces the values of the secrets in the string.
+func Redact(s string, secrets []string) string {
+	for _, v := range secretValues(secrets) {
+		s = strings.ReplaceAll(s, v, Redacted)
+	}
+	return s
+}
+
+// secretValues returns the values of the secrets given as NAME=VALUE.
+// Longer values come first so that a value containing another one
+// is redacted as a whole.
+func secretValues(secrets []string) []string {
+	var ret []string
+	for _, s := range secrets {
+		kv := strings.SplitN(s, "=", 2)
+		if len(kv) == 2 && kv[1] != "" {
+			ret = append(ret, kv[1])
+		}
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return len(ret[i]) > len(ret[j])
+	})
+	return ret
+}
@@ -0,0 +1,32 @@
+package config
+
+import (
+	"strings"
+	"syscall"
+)
+
+var signals = map[string]syscall.Signal{
+	"SIGHUP":  syscall.SIGHUP,
+	"SIGINT":  syscall.SIGINT,
+	"SIGQUIT": syscall.SIGQUIT,
+	"SIGKILL": syscall.SIGKILL,
+	"SIGUSR1": syscall.SIGUSR1,
+	"SIGUSR2": syscall.SIGUSR2,
+	"SIGTERM": syscall.SIGTERM,
+}
+
+// normalizeSignal returns the name of the signal in the form of SIGXXX.
+// The name can be given with or without the SIG prefix.
+func normalizeSignal(name string) string {
+	name = strings.ToUpper(strings.TrimSpace(name))
+	if !strings.HasPrefix(name, "SIG") {
+		name = "SIG" + name
+	}
+	return name
+}
+
+// SignalByName returns the signal of the name such as SIGINT.
+func SignalByName(name string) (syscall.Signal, bool) {
+	sig, ok := signals[normalizeSignal(name)]
+	return sig, ok
+}
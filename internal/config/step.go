@@ -2,27 +2,115 @@ package config
 
 import (
 	"fmt"
+	"math"
 	"strings"
 	"time"
 )
 
 type Step struct {
-	Name          string
-	Description   string
-	Variables     []string
-	Dir           string
-	Command       string
-	Args          []string
+	Name        string
+	Description string
+	Variables   []string
+	Dir         string
+	Command     string
+	Args        []string
+	Script      string
+	// ScriptArgs are passed to the script as the positional parameters.
+	ScriptArgs    []string
+	Shell         string
+	Run           string
+	Params        string
+	Output        string
 	Depends       []string
 	ContinueOn    ContinueOn
 	RetryPolicy   *RetryPolicy
 	RepeatPolicy  RepeatPolicy
 	MailOnError   bool
 	Preconditions []*Condition
+	Timeout       time.Duration
+	// Foreach is the list of the items to run the step for.
+	Foreach []string
+	// ForeachFrom is evaluated to the whitespace separated list of
+	// the items when the step starts, e.g. the output of a previous step.
+	ForeachFrom string
+	// MaxParallel is the max number of the items to run at once.
+	MaxParallel int
+	// Parent and Item are set to the steps expanded from a foreach step.
+	Parent string
+	Item   string
+	// Secrets are the secret variables given as NAME=VALUE.
+	// They are not saved in the status.
+	Secrets []string `json:"-"`
+	// InheritEnv selects the variables of the environment
+	// of the dagu process to pass to the command.
+	InheritEnv *InheritEnv
+	// SignalOnStop is the name of the signal sent to the
+	// process group of the step to stop it (default: the
+	// signal the agent received).
+	SignalOnStop string
+	// Priority decides which of the ready steps starts first when
+	// the slots of MaxActiveRuns are scarce. Higher runs first.
+	Priority int
+	// Weight is the number of the slots of MaxActiveRuns the step
+	// takes while it runs (default: 1).
+	Weight int
+	// Pool is the name of the pool shared across DAGs, from which
+	// the step takes a slot to run.
+	Pool string
+}
+
+// ItemVariable is the name of the variable to refer to the item
+// in the steps expanded from a foreach step.
+const ItemVariable = "ITEM"
+
+// Slots returns the number of the slots of MaxActiveRuns the step takes.
+func (s *Step) Slots() int {
+	if s.Weight > 0 {
+		return s.Weight
+	}
+	return 1
+}
+
+// IsForeach returns true if the step is expanded for each item.
+func (s *Step) IsForeach() bool {
+	return len(s.Foreach) > 0 || s.ForeachFrom != ""
 }
 
 type RetryPolicy struct {
-	Limit int
+	Limit       int
+	Interval    time.Duration
+	Backoff     float64
+	MaxInterval time.Duration
+	ExitCodes   []int
+}
+
+// IntervalFor returns the interval to wait before the n-th retry
+// (1-based). The interval is multiplied by the backoff for each
+// retry and capped at the max interval if specified.
+func (p *RetryPolicy) IntervalFor(n int) time.Duration {
+	interval := float64(p.Interval)
+	if p.Backoff > 1 {
+		interval *= math.Pow(p.Backoff, float64(n-1))
+	}
+	if p.MaxInterval > 0 && interval > float64(p.MaxInterval) {
+		return p.MaxInterval
+	}
+	return time.Duration(interval)
+}
+
+// Retryable returns true if a failure with the exit code
+// should be retried. All failures are retried when no exit
+// codes are specified.
+func (p *RetryPolicy) Retryable(exitCode int) bool {
+	if len(p.ExitCodes) == 0 {
+		return true
+	}
+	for _, c := range p.ExitCodes {
+		if c == exitCode {
+			return true
+		}
+	}
+	return false
 }
 
 type RepeatPolicy struct {
@@ -41,6 +129,14 @@ func (s *Step) String() string {
 	vals = append(vals, fmt.Sprintf("Dir: %s", s.Dir))
 	vals = append(vals, fmt.Sprintf("Command: %s", s.Command))
 	vals = append(vals, fmt.Sprintf("Args: %s", s.Args))
+	if s.Script != "" {
+		vals = append(vals, fmt.Sprintf("Script: %q", s.Script))
+		vals = append(vals, fmt.Sprintf("Shell: %s", s.Shell))
+	}
+	if s.Run != "" {
+		vals = append(vals, fmt.Sprintf("Run: %s", s.Run))
+		vals = append(vals, fmt.Sprintf("Params: %s", s.Params))
+	}
 	vals = append(vals, fmt.Sprintf("Depends: [%s]", strings.Join(s.Depends, ", ")))
 	return strings.Join(vals, "\t")
 }
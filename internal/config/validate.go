@@ -0,0 +1,311 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+// ValidationError is a problem found in a DAG file.
+// Line is 0 when the problem is not located in the file.
+type ValidationError struct {
+	File    string
+	Line    int
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	if e.Line == 0 {
+		return fmt.Sprintf("%s: %s", e.File, e.Message)
+	}
+	return fmt.Sprintf("%s:%d: %s", e.File, e.Line, e.Message)
+}
+
+// Validate checks the DAG file and the files it extends or includes
+// for unknown keys, dependencies on unknown steps, cyclic dependencies
+// and duplicate step names. It reports all the problems found with
+// their locations instead of stopping at the first one.
+func (cl *Loader) Validate(file string) []*ValidationError {
+	file, err := filepath.Abs(file)
+	if err != nil {
+		return []*ValidationError{{File: file, Message: err.Error()}}
+	}
+	v := &validator{docs: map[string]*yamlv3.Node{}, checked: map[string]bool{}}
+	steps := v.checkFile(file, false, map[string]bool{})
+	v.checkSteps(steps)
+	sort.SliceStable(v.errs, func(i, j int) bool {
+		if v.errs[i].File != v.errs[j].File {
+			return v.errs[i].File < v.errs[j].File
+		}
+		return v.errs[i].Line < v.errs[j].Line
+	})
+	return v.errs
+}
+
+type validator struct {
+	docs    map[string]*yamlv3.Node
+	checked map[string]bool
+	errs    []*ValidationError
+}
+
+// stepLocation is a step and the file and the line it is defined at.
+type stepLocation struct {
+	file    string
+	node    *yamlv3.Node
+	name    string
+	depends []*yamlv3.Node
+}
+
+func (v *validator) addError(file string, line int, format string, a ...interface{}) {
+	v.errs = append(v.errs, &ValidationError{
+		File:    file,
+		Line:    line,
+		Message: fmt.Sprintf(format, a...),
+	})
+}
+
+var yamlErrorLine = regexp.MustCompile(`line (\d+): `)
+
+// parse reads the file into a YAML node. It returns nil if the file
+// can not be read or parsed.
+func (v *validator) parse(file string) *yamlv3.Node {
+	if doc, ok := v.docs[file]; ok {
+		return doc
+	}
+	v.docs[file] = nil
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		v.addError(file, 0, "%v", err)
+		return nil
+	}
+	doc := &yamlv3.Node{}
+	if err := yamlv3.Unmarshal(data, doc); err != nil {
+		line := 0
+		msg := err.Error()
+		if m := yamlErrorLine.FindStringSubmatch(msg); m != nil {
+			line, _ = strconv.Atoi(m[1])
+			msg = strings.Replace(msg, m[0], "", 1)
+		}
+		v.addError(file, line, "%s", msg)
+		return nil
+	}
+	if len(doc.Content) == 0 {
+		doc = &yamlv3.Node{Kind: yamlv3.MappingNode}
+	} else {
+		doc = doc.Content[0]
+	}
+	if doc.Kind != yamlv3.MappingNode {
+		v.addError(file, doc.Line, "DAG definition must be a map")
+		return nil
+	}
+	v.docs[file] = doc
+	return doc
+}
+
+// checkFile checks the keys in the file and the files it extends
+// or includes, and returns the steps of the resolved definition.
+func (v *validator) checkFile(file string, included bool, visited map[string]bool) []*stepLocation {
+	if visited[file] {
+		v.addError(file, 0, "circular extends")
+		return nil
+	}
+	visited[file] = true
+	doc := v.parse(file)
+	if doc == nil {
+		return nil
+	}
+	dir := filepath.Dir(file)
+	report := !v.checked[file]
+	v.checked[file] = true
+
+	var steps, includes []*stepLocation
+	var base string
+	hasSteps, hasInclude := false, false
+	for i := 0; i+1 < len(doc.Content); i += 2 {
+		k, val := doc.Content[i], doc.Content[i+1]
+		switch {
+		case included && k.Value != keySteps:
+			if report {
+				v.addError(file, k.Line, "only steps can be included: %s", k.Value)
+			}
+		case k.Value == keyExtends:
+			base = resolvePath(dir, val.Value)
+		case k.Value == keyInclude:
+			hasInclude = true
+			files := []*yamlv3.Node{val}
+			if val.Kind == yamlv3.SequenceNode {
+				files = val.Content
+			}
+			for _, f := range files {
+				p := resolvePath(dir, f.Value)
+				includes = append(includes, v.checkFile(p, true, map[string]bool{})...)
+			}
+		case k.Value == keySteps:
+			hasSteps = true
+			steps = v.readSteps(file, val, report)
+			if included && report {
+				v.checkKeys(file, val, reflect.TypeOf([]*stepDef{}))
+			}
+		}
+	}
+	if !included && report {
+		v.checkKeys(file, doc, reflect.TypeOf(configDefinition{}), keyExtends, keyInclude)
+	}
+
+	// the steps are resolved in the same way as resolve does
+	steps = append(includes, steps...)
+	if base != "" {
+		baseSteps := v.checkFile(base, false, visited)
+		if !hasSteps && !hasInclude {
+			steps = baseSteps
+		}
+	}
+	return steps
+}
+
+func (v *validator) readSteps(file string, node *yamlv3.Node, report bool) []*stepLocation {
+	if node.Kind != yamlv3.SequenceNode {
+		if report {
+			v.addError(file, node.Line, "steps must be a list")
+		}
+		return nil
+	}
+	var ret []*stepLocation
+	for _, s := range node.Content {
+		if s.Kind != yamlv3.MappingNode {
+			if report {
+				v.addError(file, s.Line, "step must be a map")
+			}
+			continue
+		}
+		loc := &stepLocation{file: file, node: s}
+		for i := 0; i+1 < len(s.Content); i += 2 {
+			k, val := s.Content[i], s.Content[i+1]
+			switch strings.ToLower(k.Value) {
+			case "name":
+				loc.name = val.Value
+			case "depends":
+				if val.Kind == yamlv3.SequenceNode {
+					loc.depends = val.Content
+				}
+			}
+		}
+		ret = append(ret, loc)
+	}
+	return ret
+}
+
+// checkKeys reports the keys of the node that do not match any field
+// of the type in the same way as the keys are decoded to the definition.
+func (v *validator) checkKeys(file string, node *yamlv3.Node, t reflect.Type, extra ...string) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Slice:
+		if node.Kind == yamlv3.SequenceNode {
+			for _, n := range node.Content {
+				v.checkKeys(file, n, t.Elem())
+			}
+		}
+		return
+	case reflect.Struct:
+	default:
+		return
+	}
+	if node.Kind != yamlv3.MappingNode {
+		return
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		k, val := node.Content[i], node.Content[i+1]
+		if contains(extra, k.Value) {
+			continue
+		}
+		f, ok := fieldByName(t, k.Value)
+		if !ok {
+			v.addError(file, k.Line, "unknown key %q", k.Value)
+			continue
+		}
+		v.checkKeys(file, val, f.Type)
+	}
+}
+
+func fieldByName(t reflect.Type, name string) (reflect.StructField, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		if strings.EqualFold(t.Field(i).Name, name) {
+			return t.Field(i), true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// checkSteps reports duplicate step names, dependencies
+// on unknown steps and cyclic dependencies.
+func (v *validator) checkSteps(steps []*stepLocation) {
+	byName := map[string]*stepLocation{}
+	for _, s := range steps {
+		if s.name == "" {
+			continue
+		}
+		if d, ok := byName[s.name]; ok {
+			v.addError(s.file, s.node.Line, "duplicate step name %q (first defined at %s:%d)",
+				s.name, d.file, d.node.Line)
+			continue
+		}
+		byName[s.name] = s
+	}
+	for _, s := range steps {
+		for _, d := range s.depends {
+			if _, ok := byName[d.Value]; !ok {
+				v.addError(s.file, d.Line, "step %q depends on unknown step %q", s.name, d.Value)
+			}
+		}
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := map[string]int{}
+	// the cycle is reported at the dependency that closes it
+	var visit func(s *stepLocation, path []string, file string, line int)
+	visit = func(s *stepLocation, path []string, file string, line int) {
+		switch state[s.name] {
+		case visiting:
+			v.addError(file, line, "cyclic dependency: %s",
+				strings.Join(append(path, s.name), " -> "))
+			return
+		case visited:
+			return
+		}
+		state[s.name] = visiting
+		for _, d := range s.depends {
+			if u, ok := byName[d.Value]; ok {
+				visit(u, append(path, s.name), s.file, d.Line)
+			}
+		}
+		state[s.name] = visited
+	}
+	for _, s := range steps {
+		if s.name != "" && state[s.name] == unvisited {
+			visit(s, nil, s.file, s.node.Line)
+		}
+	}
+}
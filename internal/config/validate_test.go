@@ -0,0 +1,95 @@
+package config
+
+import (
+	"encoding/json"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/yohamta/dagu/internal/utils"
+)
+
+func TestValidate(t *testing.T) {
+	l := &Loader{
+		HomeDir: utils.MustGetUserHomeDir(),
+	}
+	for _, file := range []string{
+		"config_load.yaml",
+		"config_extends.yaml",
+		"config_foreach.yaml",
+	} {
+		require.Empty(t, l.Validate(path.Join(testDir, file)), file)
+	}
+}
+
+func TestValidateError(t *testing.T) {
+	l := &Loader{
+		HomeDir: utils.MustGetUserHomeDir(),
+	}
+
+	file := path.Join(testDir, "config_err_validate.yaml")
+	var errs []string
+	for _, err := range l.Validate(file) {
+		errs = append(errs, err.Error())
+	}
+	require.Equal(t, []string{
+		file + `:2: unknown key "unknownKey"`,
+		file + `:6: unknown key "depend"`,
+		file + `:15: cyclic dependency: 2 -> 3 -> 2`,
+		file + `:16: step "3" depends on unknown step "4"`,
+		file + `:17: duplicate step name "1" (first defined at ` + file + `:4)`,
+		file + `:21: unknown key "interval"`,
+	}, errs)
+
+	file = path.Join(testDir, "config_err_validate_include.yaml")
+	steps := path.Join(testDir, "config_err_validate_steps.yaml")
+	errs = nil
+	for _, err := range l.Validate(file) {
+		errs = append(errs, err.Error())
+	}
+	require.Equal(t, []string{
+		file + `:5: duplicate step name "own step" (first defined at ` + steps + `:3)`,
+		steps + `:1: only steps can be included: name`,
+		steps + `:5: unknown key "unknown"`,
+	}, errs)
+
+	errs = nil
+	for _, err := range l.Validate(path.Join(testDir, "config_err_extends_circular.yaml")) {
+		errs = append(errs, err.Error())
+	}
+	require.Len(t, errs, 1)
+	require.Contains(t, errs[0], "circular extends")
+}
+
+// TestSchema checks that the JSON Schema has all the keys of the definition.
+func TestSchema(t *testing.T) {
+	b, err := os.ReadFile(path.Join(utils.MustGetwd(), "../../schemas/dag.schema.json"))
+	require.NoError(t, err)
+	schema := struct {
+		Properties  map[string]interface{}
+		Definitions struct {
+			Step struct {
+				Properties map[string]interface{}
+			}
+		}
+	}{}
+	require.NoError(t, json.Unmarshal(b, &schema))
+
+	requireKeys := func(props map[string]interface{}, v interface{}, extra ...string) {
+		var keys []string
+		for k := range props {
+			keys = append(keys, strings.ToLower(k))
+		}
+		want := append([]string{}, extra...)
+		typ := reflect.TypeOf(v)
+		for i := 0; i < typ.NumField(); i++ {
+			want = append(want, strings.ToLower(typ.Field(i).Name))
+		}
+		require.ElementsMatch(t, want, keys)
+	}
+	requireKeys(schema.Properties, configDefinition{}, keyExtends, keyInclude)
+	requireKeys(schema.Definitions.Step.Properties, stepDef{})
+}
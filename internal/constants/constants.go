@@ -11,3 +11,28 @@ const (
 	TimeFormat = "2006-01-02 15:04:05"
 	TimeEmpty  = "-"
 )
+
+// Variables of the run context passed to the steps.
+// EnvStatus and EnvFailedSteps are passed only to the handlers.
+const (
+	EnvDAGName          = "DAG_NAME"
+	EnvRequestId        = "DAG_REQUEST_ID"
+	EnvStepName         = "DAG_STEP_NAME"
+	EnvStepLogFile      = "DAG_STEP_LOG_FILE"
+	EnvSchedulerLogFile = "DAG_SCHEDULER_LOG_FILE"
+	EnvStepRetryCount   = "DAG_STEP_RETRY_COUNT"
+	EnvStatus           = "DAG_STATUS"
+	EnvFailedSteps      = "DAG_FAILED_STEPS"
+)
+
+// RunContextVariables are the names of the variables of the run context.
+var RunContextVariables = map[string]bool{
+	EnvDAGName:          true,
+	EnvRequestId:        true,
+	EnvStepName:         true,
+	EnvStepLogFile:      true,
+	EnvSchedulerLogFile: true,
+	EnvStepRetryCount:   true,
+	EnvStatus:           true,
+	EnvFailedSteps:      true,
+}
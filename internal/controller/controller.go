@@ -20,6 +20,8 @@ import (
 
 type Controller interface {
 	Stop() error
+	Pause() error
+	Resume() error
 	Start(bin string, workDir string, params string) error
 	Retry(bin string, workDir string, reqId string) error
 	GetStatus() (*models.Status, error)
@@ -64,9 +66,40 @@ func New(cfg *config.Config) Controller {
 	}
 }
 
+// Stop stops the running DAG, or all the runs of the DAG
+// running in parallel.
 func (s *controller) Stop() error {
-	client := sock.Client{Addr: sock.GetSockAddr(s.cfg.ConfigPath)}
-	_, err := client.Request("POST", "/stop")
+	return s.post("/stop")
+}
+
+// Pause pauses the running DAG, or all the runs of the DAG
+// running in parallel. The running steps continue to run
+// but no new step is started until it is resumed.
+func (s *controller) Pause() error {
+	return s.post("/pause")
+}
+
+// Resume resumes the paused DAG, or all the runs of the DAG
+// running in parallel.
+func (s *controller) Resume() error {
+	return s.post("/resume")
+}
+
+// post sends the request to the agents of all the runs of the DAG.
+// It succeeds if any of the agents accepts it.
+func (s *controller) post(path string) (err error) {
+	sent := false
+	for _, addr := range s.sockAddrs() {
+		client := sock.Client{Addr: addr}
+		if _, e := client.Request("POST", path); e != nil {
+			err = e
+			continue
+		}
+		sent = true
+	}
+	if sent {
+		return nil
+	}
 	return err
 }
 
@@ -74,7 +107,7 @@ func (s *controller) Start(bin string, workDir string, params string) (err error
 	go func() {
 		args := []string{"start"}
 		if params != "" {
-			args = append(args, fmt.Sprintf("--params=\"%s\"", params))
+			args = append(args, fmt.Sprintf("--params=%s", params))
 		}
 		args = append(args, s.cfg.ConfigPath)
 		cmd := exec.Command(bin, args...)
@@ -107,8 +140,7 @@ func (s *controller) Retry(bin string, workDir string, reqId string) (err error)
 }
 
 func (s *controller) GetStatus() (*models.Status, error) {
-	client := sock.Client{Addr: sock.GetSockAddr(s.cfg.ConfigPath)}
-	ret, err := client.Request("GET", "/status")
+	ret, err := s.requestStatus()
 	if err != nil {
 		if errors.Is(err, sock.ErrTimeout) {
 			return nil, err
@@ -119,9 +151,32 @@ func (s *controller) GetStatus() (*models.Status, error) {
 	return models.StatusFromJson(ret)
 }
 
+// sockAddrs returns the addresses of the sockets of the agents of
+// the DAG, including the ones of the runs running in parallel.
+func (s *controller) sockAddrs() []string {
+	return append([]string{sock.GetSockAddr(s.cfg.ConfigPath)},
+		sock.InstanceSockAddrs(s.cfg.ConfigPath)...)
+}
+
+// requestStatus returns the status of the first of the running
+// agents of the DAG that responds.
+func (s *controller) requestStatus() (string, error) {
+	var err error
+	for _, addr := range s.sockAddrs() {
+		client := sock.Client{Addr: addr}
+		ret, e := client.Request("GET", "/status")
+		if e == nil {
+			return ret, nil
+		}
+		if err == nil || errors.Is(e, sock.ErrTimeout) {
+			err = e
+		}
+	}
+	return "", err
+}
+
 func (s *controller) GetLastStatus() (*models.Status, error) {
-	client := sock.Client{Addr: sock.GetSockAddr(s.cfg.ConfigPath)}
-	ret, err := client.Request("GET", "/status")
+	ret, err := s.requestStatus()
 	if err == nil {
 		return models.StatusFromJson(ret)
 	}
@@ -137,6 +192,9 @@ func (s *controller) GetLastStatus() (*models.Status, error) {
 			}
 			return defaultStatus(s.cfg), readErr
 		}
+		if status.IsStale() {
+			s.recoverStatus(db, status)
+		}
 		return status, nil
 	}
 	return nil, err
@@ -145,7 +203,10 @@ func (s *controller) GetLastStatus() (*models.Status, error) {
 func (s *controller) GetStatusByRequestId(requestId string) (*models.Status, error) {
 	db := database.New(database.DefaultConfig())
 	ret, err := db.FindByRequestId(s.cfg.ConfigPath, requestId)
-	return ret.Status, err
+	if err != nil {
+		return nil, err
+	}
+	return ret.Status, nil
 }
 
 func (s *controller) GetStatusHist(n int) []*models.StatusFile {
@@ -155,16 +216,18 @@ func (s *controller) GetStatusHist(n int) []*models.StatusFile {
 }
 
 func (s *controller) UpdateStatus(status *models.Status) error {
-	client := sock.Client{Addr: sock.GetSockAddr(s.cfg.ConfigPath)}
-	res, err := client.Request("GET", "/status")
-	if err != nil {
-		if errors.Is(err, sock.ErrTimeout) {
-			return err
+	for _, addr := range s.sockAddrs() {
+		client := sock.Client{Addr: addr}
+		res, err := client.Request("GET", "/status")
+		if err != nil {
+			if errors.Is(err, sock.ErrTimeout) {
+				return err
+			}
+			continue
 		}
-	} else {
 		ss, _ := models.StatusFromJson(res)
 		if ss != nil && ss.RequestId == status.RequestId &&
-			ss.Status == scheduler.SchedulerStatus_Running {
+			ss.Status.IsRunning() {
 			return fmt.Errorf("the DAG is running")
 		}
 	}
@@ -173,7 +236,34 @@ func (s *controller) UpdateStatus(status *models.Status) error {
 	if err != nil {
 		return err
 	}
-	w := &database.Writer{Target: toUpdate.File}
+	return writeStatus(toUpdate.File, status)
+}
+
+// recoverStatus rewrites the status of the run whose agent is
+// gone as failed, so that it is not shown as running forever.
+func (s *controller) recoverStatus(db *database.Database, status *models.Status) {
+	sf, err := db.FindByRequestId(s.cfg.ConfigPath, status.RequestId)
+	if err != nil {
+		utils.LogIgnoreErr("recover status", err)
+		return
+	}
+	status.SetAgentTerminated()
+	utils.LogIgnoreErr("recover status", writeStatus(sf.File, status))
+}
+
+// RecoverStaleStatus rewrites the status of the status file
+// as failed if the agent of the run is gone. It returns true
+// if the status has been rewritten.
+func RecoverStaleStatus(sf *models.StatusFile) (bool, error) {
+	if !sf.Status.IsStale() {
+		return false, nil
+	}
+	sf.Status.SetAgentTerminated()
+	return true, writeStatus(sf.File, sf.Status)
+}
+
+func writeStatus(file string, status *models.Status) error {
+	w := &database.Writer{Target: file}
 	if err := w.Open(); err != nil {
 		return err
 	}
@@ -2,6 +2,7 @@ package controller_test
 
 import (
 	"os"
+	"os/exec"
 	"path"
 	"path/filepath"
 	"testing"
@@ -11,8 +12,10 @@ import (
 	"github.com/stretchr/testify/require"
 	"github.com/yohamta/dagu/internal/agent"
 	"github.com/yohamta/dagu/internal/controller"
+	"github.com/yohamta/dagu/internal/models"
 	"github.com/yohamta/dagu/internal/scheduler"
 	"github.com/yohamta/dagu/internal/settings"
+	"github.com/yohamta/dagu/internal/sock"
 	"github.com/yohamta/dagu/internal/utils"
 )
 
@@ -150,6 +153,38 @@ func TestUpdateStatusError(t *testing.T) {
 	require.Error(t, err)
 }
 
+func TestGetLastStatusAgentKilled(t *testing.T) {
+	file := testConfig("controller_agent_killed.yaml")
+	dag, err := controller.FromConfig(file)
+	require.NoError(t, err)
+
+	cmd := exec.Command(path.Join(utils.MustGetwd(), "../../bin/dagu"), "start", file)
+	require.NoError(t, cmd.Start())
+
+	c := controller.New(dag.Config)
+	require.Eventually(t, func() bool {
+		st, err := c.GetStatus()
+		return err == nil && st.Status == scheduler.SchedulerStatus_Running
+	}, time.Second*3, time.Millisecond*50)
+
+	require.NoError(t, cmd.Process.Kill())
+	_ = cmd.Wait()
+	defer os.Remove(sock.GetSockAddr(dag.Config.ConfigPath))
+
+	st, err := c.GetLastStatus()
+	require.NoError(t, err)
+	require.Equal(t, scheduler.SchedulerStatus_Error, st.Status)
+	for _, n := range st.Nodes {
+		require.Equal(t, scheduler.NodeStatusCancel, n.Status)
+		require.Equal(t, models.ErrAgentTerminated, n.Error)
+	}
+
+	// the status file is rewritten
+	hist := c.GetStatusHist(1)
+	require.Equal(t, 1, len(hist))
+	require.Equal(t, scheduler.SchedulerStatus_Error, hist[0].Status.Status)
+}
+
 func TestStartStop(t *testing.T) {
 	file := testConfig("controller_start.yaml")
 	dag, err := controller.FromConfig(file)
@@ -186,6 +221,7 @@ func TestRetry(t *testing.T) {
 	s, err := c.GetLastStatus()
 	require.Equal(t, scheduler.SchedulerStatus_Success, s.Status)
 	require.NoError(t, err)
+	require.Equal(t, "x y z", s.Params)
 
 	err = c.Retry(path.Join(utils.MustGetwd(), "../../bin/dagu"), "", s.RequestId)
 	require.NoError(t, err)
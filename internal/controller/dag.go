@@ -2,19 +2,22 @@ package controller
 
 import (
 	"path/filepath"
+	"time"
 
 	"github.com/yohamta/dagu/internal/config"
 	"github.com/yohamta/dagu/internal/models"
 	"github.com/yohamta/dagu/internal/scheduler"
+	"github.com/yohamta/dagu/internal/utils"
 )
 
 type DAG struct {
-	File   string
-	Dir    string
-	Config *config.Config
-	Status *models.Status
-	Error  error
-	ErrorT *string
+	File    string
+	Dir     string
+	Config  *config.Config
+	Status  *models.Status
+	Error   error
+	ErrorT  *string
+	NextRun string
 }
 
 func FromConfig(file string) (*DAG, error) {
@@ -57,6 +60,7 @@ func newDAG(cfg *config.Config, s *models.Status, err error) *DAG {
 		Status: s,
 		Error:  err,
 	}
+	ret.NextRun = utils.FormatTime(cfg.NextRun(time.Now()))
 	if err != nil {
 		errT := err.Error()
 		ret.ErrorT = &errT
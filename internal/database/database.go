@@ -59,8 +59,11 @@ func ParseFile(file string) (*models.Status, error) {
 	return m, nil
 }
 
-func (db *Database) NewWriter(configPath string, t time.Time) (*Writer, string, error) {
-	f, err := db.newFile(configPath, t)
+// NewWriter returns the writer of the status file of the run. The
+// request ID is a part of the file name, so that the runs started at
+// the same time in parallel write to their own files.
+func (db *Database) NewWriter(configPath string, t time.Time, requestId string) (*Writer, string, error) {
+	f, err := db.newFile(configPath, t, requestId)
 	if err != nil {
 		return nil, "", err
 	}
@@ -83,6 +86,22 @@ func (db *Database) ReadStatusHist(configPath string, n int) []*models.StatusFil
 	return ret
 }
 
+// ReadStatusAll returns the status files of all the DAGs.
+func (db *Database) ReadStatusAll() []*models.StatusFile {
+	ret := make([]*models.StatusFile, 0)
+	files, _ := filepath.Glob(filepath.Join(db.Dir, "*", "*.dat"))
+	for _, file := range files {
+		status, err := ParseFile(file)
+		if err == nil {
+			ret = append(ret, &models.StatusFile{
+				File:   file,
+				Status: status,
+			})
+		}
+	}
+	return ret
+}
+
 func (db *Database) ReadStatusToday(configPath string) (*models.Status, error) {
 	file, err := db.latestToday(configPath, time.Now())
 	if err != nil {
@@ -175,12 +194,15 @@ func (db *Database) dir(configPath string, prefix string) string {
 	return filepath.Join(db.Dir, fmt.Sprintf("%s-%s", prefix, v))
 }
 
-func (db *Database) newFile(configPath string, t time.Time) (string, error) {
+func (db *Database) newFile(configPath string, t time.Time, requestId string) (string, error) {
 	if configPath == "" {
 		return "", fmt.Errorf("configPath is empty")
 	}
-	fileName := fmt.Sprintf("%s.%s.dat", db.pattern(configPath), t.Format("20060102.15:04:05"))
-	return fileName, nil
+	fileName := fmt.Sprintf("%s.%s", db.pattern(configPath), t.Format("20060102.15:04:05"))
+	if requestId != "" {
+		fileName = fmt.Sprintf("%s.%s", fileName, utils.ValidFilename(requestId, "_"))
+	}
+	return fileName + ".dat", nil
 }
 
 func (db *Database) pattern(configPath string) string {
@@ -52,13 +52,17 @@ func testNewDataFile(t *testing.T, db *Database) {
 		ConfigPath: "test_new_data_file.yaml",
 	}
 	timestamp := time.Date(2022, 1, 1, 0, 0, 0, 0, time.Local)
-	f, err := db.newFile(cfg.ConfigPath, timestamp)
+	f, err := db.newFile(cfg.ConfigPath, timestamp, "")
 	require.NoError(t, err)
 	p := utils.ValidFilename(strings.TrimSuffix(
 		path.Base(cfg.ConfigPath), path.Ext(cfg.ConfigPath)), "_")
 	assert.Regexp(t, fmt.Sprintf("%s.*/%s.20220101.00:00:00.dat", p, p), f)
 
-	_, err = db.newFile("", timestamp)
+	f, err = db.newFile(cfg.ConfigPath, timestamp, "request-id")
+	require.NoError(t, err)
+	assert.Regexp(t, fmt.Sprintf("%s.*/%s.20220101.00:00:00.request-id.dat", p, p), f)
+
+	_, err = db.newFile("", timestamp, "")
 	require.Error(t, err)
 }
 
@@ -176,7 +180,7 @@ func testReadLatestStatus(t *testing.T, db *Database) {
 	cfg := &config.Config{
 		ConfigPath: "test_config_status_reader.yaml",
 	}
-	dw, _, err := db.NewWriter(cfg.ConfigPath, time.Now())
+	dw, _, err := db.NewWriter(cfg.ConfigPath, time.Now(), "")
 	require.NoError(t, err)
 	err = dw.Open()
 	require.NoError(t, err)
@@ -239,7 +243,7 @@ func testCompactFile(t *testing.T, db *Database) {
 		ConfigPath: "test_compact_file.yaml",
 	}
 
-	dw, _, err := db.NewWriter(cfg.ConfigPath, time.Now())
+	dw, _, err := db.NewWriter(cfg.ConfigPath, time.Now(), "")
 	require.NoError(t, err)
 	require.NoError(t, dw.Open())
 
@@ -286,7 +290,7 @@ func testErrorReadFile(t *testing.T, db *Database) {
 	_, err := ParseFile("invalid_file.dat")
 	require.Error(t, err)
 
-	_, _, err = db.NewWriter("", time.Now())
+	_, _, err = db.NewWriter("", time.Now(), "")
 	require.Error(t, err)
 
 	_, err = db.ReadStatusToday("invalid_file.yaml")
@@ -324,7 +328,7 @@ func testErrorParseFile(t *testing.T, db *Database) {
 
 func testWriteStatus(t *testing.T, db *Database, cfg *config.Config, status *models.Status, tm time.Time) {
 	t.Helper()
-	dw, _, err := db.NewWriter(cfg.ConfigPath, tm)
+	dw, _, err := db.NewWriter(cfg.ConfigPath, tm, "")
 	require.NoError(t, err)
 	require.NoError(t, dw.Open())
 	defer dw.Close()
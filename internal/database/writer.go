@@ -2,6 +2,7 @@ package database
 
 import (
 	"bufio"
+	"errors"
 	"os"
 	"path"
 	"strings"
@@ -11,6 +12,10 @@ import (
 	"github.com/yohamta/dagu/internal/utils"
 )
 
+// ErrWriterClosed is returned when the status is written
+// after the writer is closed.
+var ErrWriterClosed = errors.New("the status file is closed")
+
 type Writer struct {
 	Target string
 	writer *bufio.Writer
@@ -31,6 +36,9 @@ func (w *Writer) Open() (err error) {
 func (w *Writer) Write(st *models.Status) error {
 	w.mu.Lock()
 	defer w.mu.Unlock()
+	if w.closed {
+		return ErrWriterClosed
+	}
 	jsonb, _ := st.ToJson()
 	str := strings.ReplaceAll(string(jsonb), "\n", " ")
 	str = strings.ReplaceAll(str, "\r", " ")
@@ -40,6 +48,8 @@ func (w *Writer) Write(st *models.Status) error {
 }
 
 func (w *Writer) Close() (err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
 	if !w.closed {
 		err = w.writer.Flush()
 		utils.LogIgnoreErr("flush file", err)
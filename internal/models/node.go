@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"fmt"
 	"strings"
+	"unicode"
 
 	"github.com/yohamta/dagu/internal/config"
 	"github.com/yohamta/dagu/internal/scheduler"
@@ -11,15 +12,26 @@ import (
 )
 
 type Node struct {
-	*config.Step `json:"Step"`
-	Log          string               `json:"Log"`
-	StartedAt    string               `json:"StartedAt"`
-	FinishedAt   string               `json:"FinishedAt"`
-	Status       scheduler.NodeStatus `json:"Status"`
-	RetryCount   int                  `json:"RetryCount"`
-	DoneCount    int                  `json:"DoneCount"`
-	Error        string               `json:"Error"`
-	StatusText   string               `json:"StatusText"`
+	*config.Step     `json:"Step"`
+	Log              string                    `json:"Log"`
+	StartedAt        string                    `json:"StartedAt"`
+	FinishedAt       string                    `json:"FinishedAt"`
+	Status           scheduler.NodeStatus      `json:"Status"`
+	RetryCount       int                       `json:"RetryCount"`
+	DoneCount        int                       `json:"DoneCount"`
+	Error            string                    `json:"Error"`
+	StatusText       string                    `json:"StatusText"`
+	SubRequestId     string                    `json:"SubRequestId"`
+	OutputValue      string                    `json:"OutputValue"`
+	ExitCode         int                       `json:"ExitCode"`
+	Attempts         []*Attempt                `json:"Attempts"`
+	ConditionResults []*config.ConditionResult `json:"ConditionResults"`
+	ForceKilled      bool                      `json:"ForceKilled"`
+}
+
+type Attempt struct {
+	StartedAt string `json:"StartedAt"`
+	ExitCode  int    `json:"ExitCode"`
 }
 
 func (n *Node) ToNode() *scheduler.Node {
@@ -32,28 +44,51 @@ func (n *Node) ToNode() *scheduler.Node {
 	ret := &scheduler.Node{
 		Step: n.Step,
 		NodeState: scheduler.NodeState{
-			Status:     n.Status,
-			Log:        n.Log,
-			StartedAt:  startedAt,
-			FinishedAt: finishedAt,
-			RetryCount: n.RetryCount,
-			DoneCount:  n.DoneCount,
-			Error:      err,
+			Status:           n.Status,
+			Log:              n.Log,
+			StartedAt:        startedAt,
+			FinishedAt:       finishedAt,
+			RetryCount:       n.RetryCount,
+			DoneCount:        n.DoneCount,
+			Error:            err,
+			SubRequestId:     n.SubRequestId,
+			OutputValue:      n.OutputValue,
+			ExitCode:         n.ExitCode,
+			ConditionResults: n.ConditionResults,
+			ForceKilled:      n.ForceKilled,
 		},
 	}
+	for _, a := range n.Attempts {
+		startedAt, _ := utils.ParseTime(a.StartedAt)
+		ret.Attempts = append(ret.Attempts, scheduler.Attempt{
+			StartedAt: startedAt,
+			ExitCode:  a.ExitCode,
+		})
+	}
 	return ret
 }
 
 func FromNode(n *scheduler.Node) *Node {
 	node := &Node{
-		Step:       n.Step,
-		Log:        n.Log,
-		StartedAt:  utils.FormatTime(n.StartedAt),
-		FinishedAt: utils.FormatTime(n.FinishedAt),
-		Status:     n.ReadStatus(),
-		StatusText: n.ReadStatus().String(),
-		RetryCount: n.ReadRetryCount(),
-		DoneCount:  n.ReadDoneCount(),
+		Step:             n.Step,
+		Log:              n.Log,
+		StartedAt:        utils.FormatTime(n.StartedAt),
+		FinishedAt:       utils.FormatTime(n.FinishedAt),
+		Status:           n.ReadStatus(),
+		StatusText:       n.StatusText(),
+		RetryCount:       n.ReadRetryCount(),
+		DoneCount:        n.ReadDoneCount(),
+		SubRequestId:     n.SubRequestId,
+		OutputValue:      config.Redact(n.OutputValue, n.Secrets),
+		ExitCode:         n.ExitCode,
+		ConditionResults: n.ConditionResults,
+		ForceKilled:      n.ForceKilled,
+	}
+	for _, a := range n.Attempts {
+		node.Attempts = append(node.Attempts, &Attempt{
+			StartedAt: utils.FormatTime(a.StartedAt),
+			ExitCode:  a.ExitCode,
+		})
 	}
 	if n.Error != nil {
 		node.Error = n.Error.Error()
@@ -80,8 +115,15 @@ func FromSteps(steps []*config.Step) []*Node {
 func StepGraph(steps []*Node, displayStatus bool) string {
 	var buf bytes.Buffer
 	buf.WriteString("flowchart LR;")
+	expanded := map[string]bool{}
+	for _, s := range steps {
+		if s.Parent != "" {
+			expanded[s.Parent] = true
+		}
+	}
 	for _, s := range steps {
-		buf.WriteString(fmt.Sprintf("%s(%s)", graphNode(s.Name), s.Name))
+		buf.WriteString(fmt.Sprintf("%s(\"%s\")", graphNode(s.Name),
+			strings.ReplaceAll(s.Name, `"`, "#quot;")))
 		if displayStatus {
 			switch s.Status {
 			case scheduler.NodeStatusRunning:
@@ -101,6 +143,14 @@ func StepGraph(steps []*Node, displayStatus bool) string {
 			buf.WriteString(":::none")
 		}
 		buf.WriteString(";")
+		if s.Parent != "" {
+			// the expanded steps are drawn between the upstream
+			// steps and the foreach step they were expanded from
+			buf.WriteString(graphNode(s.Name) + "-->" + graphNode(s.Parent) + ";")
+		}
+		if expanded[s.Name] {
+			continue
+		}
 		for _, d := range s.Depends {
 			buf.WriteString(graphNode(d) + "-->" + graphNode(s.Name) + ";")
 		}
@@ -115,7 +165,12 @@ func StepGraph(steps []*Node, displayStatus bool) string {
 }
 
 func graphNode(val string) string {
-	return strings.ReplaceAll(val, " ", "_")
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '-' {
+			return r
+		}
+		return '_'
+	}, val)
 }
 
 func fromStepWithDefValues(s *config.Step) *Node {
@@ -14,7 +14,7 @@ func makeStep(cmd string) *config.Step {
 	step := &config.Step{
 		Name: "test step",
 	}
-	step.Command, step.Args = utils.SplitCommand(cmd)
+	step.Command, step.Args, _ = utils.SplitCommand(cmd)
 	return step
 }
 
@@ -60,8 +60,22 @@ func TestStepGraph(t *testing.T) {
 	require.Contains(t, ret, nodes[0].Name)
 }
 
+func TestStepGraphForeach(t *testing.T) {
+	nodes := FromSteps([]*config.Step{
+		{Name: "1"},
+		{Name: "2", Depends: []string{"1"}, Foreach: []string{"a"}},
+		{Name: "2[a]", Depends: []string{"1"}, Parent: "2", Item: "a"},
+	})
+	ret := StepGraph(nodes, false)
+	require.Contains(t, ret, `2_a_("2[a]")`)
+	require.Contains(t, ret, "1-->2_a_;")
+	require.Contains(t, ret, "2_a_-->2;")
+	require.NotContains(t, ret, "1-->2;")
+}
+
 func TestGraphNodeString(t *testing.T) {
 	require.Equal(t, graphNode("test step"), "test_step")
+	require.Equal(t, graphNode("step[a.b]"), "step_a_b_")
 }
 
 func testRunSteps(t *testing.T, steps ...*config.Step) *scheduler.ExecutionGraph {
@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/yohamta/dagu/internal/config"
+	"github.com/yohamta/dagu/internal/constants"
 	"github.com/yohamta/dagu/internal/scheduler"
 	"github.com/yohamta/dagu/internal/utils"
 )
@@ -45,6 +46,7 @@ type Status struct {
 	FinishedAt string                    `json:"FinishedAt"`
 	Log        string                    `json:"Log"`
 	Params     string                    `json:"Params"`
+	StartToken string                    `json:"StartToken"`
 }
 
 type StatusFile struct {
@@ -105,3 +107,55 @@ func (sts *Status) ToJson() ([]byte, error) {
 	}
 	return js, nil
 }
+
+// ErrAgentTerminated is the error of the steps of a run whose
+// agent process exited without writing the final status.
+const ErrAgentTerminated = "agent terminated unexpectedly"
+
+// IsAgentAlive returns true if the agent process that
+// wrote the status is still running.
+func (sts *Status) IsAgentAlive() bool {
+	return utils.IsProcessAlive(int(sts.Pid), sts.StartToken)
+}
+
+// IsStale returns true if the status says the DAG is running, or
+// has been started by an agent, but the agent process is gone.
+func (sts *Status) IsStale() bool {
+	switch sts.Status {
+	case scheduler.SchedulerStatus_Running, scheduler.SchedulerStatus_Paused:
+	case scheduler.SchedulerStatus_None:
+		if !sts.Pid.IsRunning() {
+			return false
+		}
+	default:
+		return false
+	}
+	return !sts.IsAgentAlive()
+}
+
+// SetAgentTerminated marks the run as failed because the agent was
+// terminated. The running steps fail and the steps not finished are
+// canceled with ErrAgentTerminated.
+func (sts *Status) SetAgentTerminated() {
+	sts.Status = scheduler.SchedulerStatus_Error
+	sts.StatusText = sts.Status.String()
+	sts.Pid = PidNotRunning
+	if sts.FinishedAt == "" || sts.FinishedAt == constants.TimeEmpty {
+		sts.FinishedAt = utils.FormatTime(time.Now())
+	}
+	handlers := []*Node{sts.OnExit, sts.OnSuccess, sts.OnFailure, sts.OnCancel}
+	for _, n := range sts.Nodes {
+		if n.Status == scheduler.NodeStatusNone {
+			n.Status = scheduler.NodeStatusCancel
+			n.StatusText = n.Status.String()
+			n.Error = ErrAgentTerminated
+		}
+	}
+	for _, n := range append(append([]*Node{}, sts.Nodes...), handlers...) {
+		if n != nil && n.Status == scheduler.NodeStatusRunning {
+			n.Status = scheduler.NodeStatusError
+			n.StatusText = n.Status.String()
+			n.Error = ErrAgentTerminated
+		}
+	}
+}
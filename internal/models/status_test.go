@@ -1,11 +1,14 @@
 package models
 
 import (
+	"os"
 	"testing"
 	"time"
 
 	"github.com/yohamta/dagu/internal/config"
+	"github.com/yohamta/dagu/internal/constants"
 	"github.com/yohamta/dagu/internal/scheduler"
+	"github.com/yohamta/dagu/internal/utils"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -63,3 +66,40 @@ func TestStatusSerialization(t *testing.T) {
 	require.Equal(t, 1, len(st_.Nodes))
 	assert.Equal(t, cfg.Steps[0].Name, st_.Nodes[0].Name)
 }
+
+func TestSetAgentTerminated(t *testing.T) {
+	cfg := &config.Config{
+		Steps: []*config.Step{{Name: "1"}, {Name: "2"}, {Name: "3"}},
+		HandlerOn: config.HandlerOn{
+			Exit: &config.Step{Name: "onExit"},
+		},
+	}
+	st := NewStatus(cfg, nil, scheduler.SchedulerStatus_Running, 10000, nil, nil)
+	st.Nodes[0].Status = scheduler.NodeStatusSuccess
+	st.Nodes[1].Status = scheduler.NodeStatusRunning
+
+	st.Pid = Pid(os.Getpid())
+	st.StartToken = utils.ProcessStartToken(os.Getpid())
+	require.False(t, st.IsStale())
+
+	st.StartToken = "other"
+	require.True(t, st.IsStale())
+
+	st.SetAgentTerminated()
+	require.False(t, st.IsStale())
+	require.Equal(t, scheduler.SchedulerStatus_Error, st.Status)
+	require.Equal(t, PidNotRunning, st.Pid)
+	require.NotEqual(t, constants.TimeEmpty, st.FinishedAt)
+
+	require.Equal(t, scheduler.NodeStatusSuccess, st.Nodes[0].Status)
+	require.Equal(t, "", st.Nodes[0].Error)
+	require.Equal(t, scheduler.NodeStatusError, st.Nodes[1].Status)
+	require.Equal(t, ErrAgentTerminated, st.Nodes[1].Error)
+	require.Equal(t, scheduler.NodeStatusCancel, st.Nodes[2].Status)
+	require.Equal(t, ErrAgentTerminated, st.Nodes[2].Error)
+	require.Equal(t, scheduler.NodeStatusNone, st.OnExit.Status)
+
+	// a status not written by an agent
+	st = NewStatus(cfg, nil, scheduler.SchedulerStatus_None, int(PidNotRunning), nil, nil)
+	require.False(t, st.IsStale())
+}
@@ -0,0 +1,68 @@
+// Package pool provides the pools of slots shared by the agents on
+// the host, which limit the number of the steps running at once
+// across DAGs. A slot is a lock file under the directory of the pool
+// held with flock(2), so that it is released when the agent exits or
+// is killed.
+package pool
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"syscall"
+
+	"github.com/yohamta/dagu/internal/utils"
+)
+
+type Pool struct {
+	Name string
+	Size int
+	dir  string
+}
+
+// New returns the pool of the name and the size. The lock files
+// of the slots are created under dir/name, where the name is made
+// a valid file name so that the directory is always under dir.
+func New(dir, name string, size int) *Pool {
+	return &Pool{
+		Name: name,
+		Size: size,
+		dir:  path.Join(dir, utils.ValidFilename(name, "_")),
+	}
+}
+
+// Slot is a slot of a pool held by the process.
+type Slot struct {
+	file *os.File
+}
+
+// TryAcquire takes a free slot of the pool without waiting.
+// It returns nil if all the slots are taken.
+func (p *Pool) TryAcquire() (*Slot, error) {
+	if err := os.MkdirAll(p.dir, 0755); err != nil {
+		return nil, err
+	}
+	for i := 0; i < p.Size; i++ {
+		f, err := os.OpenFile(
+			path.Join(p.dir, fmt.Sprintf("slot%d.lock", i)),
+			os.O_CREATE|os.O_RDWR, 0644)
+		if err != nil {
+			return nil, err
+		}
+		err = syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+		if err == nil {
+			return &Slot{file: f}, nil
+		}
+		f.Close()
+		if !errors.Is(err, syscall.EWOULDBLOCK) {
+			return nil, err
+		}
+	}
+	return nil, nil
+}
+
+// Release gives the slot back to the pool.
+func (s *Slot) Release() error {
+	return s.file.Close()
+}
@@ -0,0 +1,43 @@
+package pool
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/yohamta/dagu/internal/utils"
+)
+
+func TestPool(t *testing.T) {
+	dir := utils.MustTempDir("pool_test")
+	defer os.RemoveAll(dir)
+
+	p := New(dir, "db", 2)
+	s1, err := p.TryAcquire()
+	require.NoError(t, err)
+	require.NotNil(t, s1)
+	s2, err := p.TryAcquire()
+	require.NoError(t, err)
+	require.NotNil(t, s2)
+
+	// the slots are shared with the other pools of the same name
+	other := New(dir, "db", 2)
+	s, err := other.TryAcquire()
+	require.NoError(t, err)
+	require.Nil(t, s)
+
+	require.NoError(t, s1.Release())
+	s, err = other.TryAcquire()
+	require.NoError(t, err)
+	require.NotNil(t, s)
+
+	// the pools of the other names are separate
+	s, err = New(dir, "api", 1).TryAcquire()
+	require.NoError(t, err)
+	require.NotNil(t, s)
+
+	// the slots are always under the directory
+	p = New(path.Join(dir, "pools"), "../x", 1)
+	require.Equal(t, path.Join(dir, "pools", ".._x"), p.dir)
+}
@@ -0,0 +1,120 @@
+// Package queue provides the queues of the runs of the DAGs waiting
+// for the running ones to end. A queue is a directory under the data
+// directory with a file for each run, in the order they were queued,
+// and a lock file to serialize the agents using the queue.
+package queue
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/yohamta/dagu/internal/utils"
+)
+
+// Item is a run of the DAG in the queue.
+type Item struct {
+	RequestId string    `json:"RequestId"`
+	Params    string    `json:"Params"`
+	QueuedAt  time.Time `json:"QueuedAt"`
+}
+
+type Queue struct {
+	dir string
+}
+
+// New returns the queue of the DAG of the config file. The files
+// of the queue are under dir.
+func New(dir, configPath string) *Queue {
+	name := strings.TrimSuffix(filepath.Base(configPath), path.Ext(configPath))
+	h := md5.New()
+	h.Write([]byte(configPath))
+	return &Queue{
+		dir: path.Join(dir, fmt.Sprintf("%s-%s",
+			utils.ValidFilename(name, "_"), hex.EncodeToString(h.Sum(nil)))),
+	}
+}
+
+// Lock waits for the lock of the queue and returns
+// the function to release it.
+func (q *Queue) Lock() (func(), error) {
+	if err := os.MkdirAll(q.dir, 0755); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path.Join(q.dir, ".lock"), os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return func() { f.Close() }, nil
+}
+
+// Push adds the run to the end of the queue.
+func (q *Queue) Push(item *Item) error {
+	if err := os.MkdirAll(q.dir, 0755); err != nil {
+		return err
+	}
+	if item.QueuedAt.IsZero() {
+		item.QueuedAt = time.Now()
+	}
+	b, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(q.file(item), b, 0644)
+}
+
+// Items returns the runs in the queue in the order they were queued.
+func (q *Queue) Items() ([]*Item, error) {
+	matches, err := filepath.Glob(path.Join(q.dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(matches)
+	var ret []*Item
+	for _, m := range matches {
+		b, err := os.ReadFile(m)
+		if err != nil {
+			return nil, err
+		}
+		item := &Item{}
+		if err := json.Unmarshal(b, item); err != nil {
+			return nil, fmt.Errorf("%s: %w", m, err)
+		}
+		ret = append(ret, item)
+	}
+	return ret, nil
+}
+
+// Remove removes the run of the request ID from the queue.
+// It returns false if the run is not in the queue.
+func (q *Queue) Remove(requestId string) (bool, error) {
+	items, err := q.Items()
+	if err != nil {
+		return false, err
+	}
+	for _, item := range items {
+		if item.RequestId == requestId {
+			return true, os.Remove(q.file(item))
+		}
+	}
+	return false, nil
+}
+
+// file returns the name of the file of the run, which begins
+// with the time it was queued so that the files sort in order.
+func (q *Queue) file(item *Item) string {
+	return path.Join(q.dir, fmt.Sprintf("%020d.%s.json",
+		item.QueuedAt.UnixNano(), utils.ValidFilename(item.RequestId, "_")))
+}
@@ -0,0 +1,75 @@
+package queue
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/yohamta/dagu/internal/utils"
+)
+
+func TestQueue(t *testing.T) {
+	dir := utils.MustTempDir("queue_test")
+	defer os.RemoveAll(dir)
+
+	q := New(dir, "/dags/test.yaml")
+	items, err := q.Items()
+	require.NoError(t, err)
+	require.Len(t, items, 0)
+
+	now := time.Now()
+	require.NoError(t, q.Push(&Item{RequestId: "2", Params: "b", QueuedAt: now}))
+	require.NoError(t, q.Push(&Item{RequestId: "1", Params: "a", QueuedAt: now.Add(-time.Second)}))
+	require.NoError(t, q.Push(&Item{RequestId: "3"}))
+
+	// the queues of the other DAGs are separate
+	items, err = New(dir, "/dags/other.yaml").Items()
+	require.NoError(t, err)
+	require.Len(t, items, 0)
+
+	items, err = q.Items()
+	require.NoError(t, err)
+	require.Len(t, items, 3)
+	require.Equal(t, "1", items[0].RequestId)
+	require.Equal(t, "a", items[0].Params)
+	require.Equal(t, "2", items[1].RequestId)
+	require.Equal(t, "3", items[2].RequestId)
+
+	removed, err := q.Remove("2")
+	require.NoError(t, err)
+	require.True(t, removed)
+	removed, err = q.Remove("2")
+	require.NoError(t, err)
+	require.False(t, removed)
+
+	items, err = q.Items()
+	require.NoError(t, err)
+	require.Len(t, items, 2)
+	require.Equal(t, "3", items[1].RequestId)
+}
+
+func TestQueueLock(t *testing.T) {
+	dir := utils.MustTempDir("queue_test")
+	defer os.RemoveAll(dir)
+
+	q := New(dir, "/dags/test.yaml")
+	unlock, err := q.Lock()
+	require.NoError(t, err)
+
+	locked := make(chan struct{})
+	go func() {
+		unlock, err := New(dir, "/dags/test.yaml").Lock()
+		require.NoError(t, err)
+		close(locked)
+		unlock()
+	}()
+
+	select {
+	case <-locked:
+		t.Fatal("the queue was locked twice")
+	case <-time.After(time.Millisecond * 100):
+	}
+	unlock()
+	<-locked
+}
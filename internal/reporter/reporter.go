@@ -24,7 +24,7 @@ type Config struct {
 func (rp *Reporter) ReportStep(cfg *config.Config, status *models.Status, node *scheduler.Node) error {
 	st := node.ReadStatus()
 	if st != scheduler.NodeStatusNone {
-		log.Printf("%s %s", node.Name, status.StatusText)
+		log.Printf("%s %s", node.Name, st)
 	}
 	if st == scheduler.NodeStatusError && node.MailOnError {
 		return rp.Mailer.SendMail(
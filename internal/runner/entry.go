@@ -0,0 +1,58 @@
+package runner
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/yohamta/dagu/internal/admin"
+	"github.com/yohamta/dagu/internal/controller"
+	"github.com/yohamta/dagu/internal/utils"
+)
+
+type Entry struct {
+	Next time.Time
+	Job  Job
+}
+
+type EntryReader interface {
+	Read(t time.Time) ([]*Entry, error)
+}
+
+type entryReader struct {
+	admin *admin.Config
+}
+
+var _ EntryReader = (*entryReader)(nil)
+
+func newEntryReader(cfg *admin.Config) *entryReader {
+	return &entryReader{admin: cfg}
+}
+
+// Read loads the DAGs in the DAGs directory and returns an entry
+// for each DAG that has a schedule. The directory is read on
+// every call, so added, removed or edited DAGs are picked up
+// without restarting the scheduler.
+func (er *entryReader) Read(t time.Time) ([]*Entry, error) {
+	dags, errs, err := controller.GetDAGs(er.admin.DAGs)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range errs {
+		utils.LogIgnoreErr("read DAG", fmt.Errorf("%s", e))
+	}
+	var ret []*Entry
+	for _, dag := range dags {
+		if dag.Error != nil || len(dag.Config.Schedule) == 0 {
+			continue
+		}
+		ret = append(ret, &Entry{
+			Next: dag.Config.NextRun(t),
+			Job: &job{
+				DAG:     dag.Config,
+				Bin:     er.admin.Command,
+				WorkDir: er.admin.WorkDir,
+			},
+		})
+	}
+	return ret, nil
+}
@@ -0,0 +1,40 @@
+package runner
+
+import (
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/yohamta/dagu/internal/admin"
+	"github.com/yohamta/dagu/internal/settings"
+	"github.com/yohamta/dagu/internal/utils"
+)
+
+var testsDir = path.Join(utils.MustGetwd(), "../../tests/runner")
+
+func TestMain(m *testing.M) {
+	tempDir := utils.MustTempDir("runner_test")
+	settings.InitTest(tempDir)
+	code := m.Run()
+	os.RemoveAll(tempDir)
+	os.Exit(code)
+}
+
+func TestReadEntries(t *testing.T) {
+	tm := time.Date(2022, 5, 1, 10, 2, 0, 0, time.Local)
+	er := newEntryReader(&admin.Config{
+		DAGs:    testsDir,
+		Command: "dagu",
+		WorkDir: testsDir,
+	})
+
+	entries, err := er.Read(tm)
+	require.NoError(t, err)
+	require.Equal(t, 1, len(entries))
+
+	e := entries[0]
+	require.Equal(t, "scheduled", e.Job.String())
+	require.Equal(t, time.Date(2022, 5, 1, 10, 5, 0, 0, time.Local), e.Next)
+}
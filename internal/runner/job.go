@@ -0,0 +1,41 @@
+package runner
+
+import (
+	"errors"
+
+	"github.com/yohamta/dagu/internal/config"
+	"github.com/yohamta/dagu/internal/controller"
+)
+
+type Job interface {
+	Run() error
+	String() string
+}
+
+type job struct {
+	DAG     *config.Config
+	Bin     string
+	WorkDir string
+}
+
+var _ Job = (*job)(nil)
+
+var ErrJobRunning = errors.New("job already running")
+
+func (j *job) Run() error {
+	c := controller.New(j.DAG)
+	s, err := c.GetStatus()
+	if err != nil {
+		return err
+	}
+	// with the other policies, the agent queues the run or runs it
+	// alongside the running ones so that the run is not lost
+	if s.Status.IsRunning() && j.DAG.OverlapPolicy == config.OverlapSkip {
+		return ErrJobRunning
+	}
+	return c.Start(j.Bin, j.WorkDir, "")
+}
+
+func (j *job) String() string {
+	return j.DAG.Name
+}
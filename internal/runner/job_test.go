@@ -0,0 +1,56 @@
+package runner
+
+import (
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/yohamta/dagu/internal/config"
+	"github.com/yohamta/dagu/internal/controller"
+	"github.com/yohamta/dagu/internal/scheduler"
+	"github.com/yohamta/dagu/internal/utils"
+)
+
+func TestJobOverlap(t *testing.T) {
+	for _, tc := range []struct {
+		file string
+		err  error
+		runs int
+	}{
+		{"overlap_skip.yaml", ErrJobRunning, 1},
+		{"overlap_queue.yaml", nil, 2},
+		{"overlap_parallel.yaml", nil, 2},
+	} {
+		t.Run(tc.file, func(t *testing.T) {
+			l := &config.Loader{HomeDir: utils.MustGetUserHomeDir()}
+			dag, err := l.Load(path.Join(testsDir, tc.file), "")
+			require.NoError(t, err)
+
+			c := controller.New(dag)
+			j := &job{
+				DAG:     dag,
+				Bin:     path.Join(utils.MustGetwd(), "../../bin/dagu"),
+				WorkDir: testsDir,
+			}
+			require.NoError(t, j.Run())
+			require.Eventually(t, func() bool {
+				s, err := c.GetStatus()
+				return err == nil && s.Status == scheduler.SchedulerStatus_Running
+			}, time.Second*3, time.Millisecond*50)
+
+			// the next tick while the DAG is running
+			require.Equal(t, tc.err, j.Run())
+
+			require.Eventually(t, func() bool {
+				runs := 0
+				for _, f := range c.GetStatusHist(10) {
+					if f.Status.Status == scheduler.SchedulerStatus_Success {
+						runs++
+					}
+				}
+				return runs == tc.runs
+			}, time.Second*10, time.Millisecond*100)
+		})
+	}
+}
@@ -0,0 +1,105 @@
+package runner
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/yohamta/dagu/internal/admin"
+)
+
+// Runner starts scheduled DAGs at the times defined by
+// their `schedule` field.
+type Runner struct {
+	*Config
+	stop    chan struct{}
+	running bool
+	mu      sync.Mutex
+}
+
+type Config struct {
+	EntryReader EntryReader
+}
+
+// New returns a runner that reads the DAGs in the directory
+// configured in the admin config.
+func New(cfg *admin.Config) *Runner {
+	return NewWithConfig(&Config{
+		EntryReader: newEntryReader(cfg),
+	})
+}
+
+func NewWithConfig(cfg *Config) *Runner {
+	return &Runner{
+		Config: cfg,
+	}
+}
+
+// Start runs the scheduling loop until Stop is called.
+// The loop wakes up at the beginning of every minute and
+// starts the jobs whose next run time has come.
+func (r *Runner) Start() {
+	r.mu.Lock()
+	if r.running {
+		r.mu.Unlock()
+		return
+	}
+	r.running = true
+	r.stop = make(chan struct{})
+	stop := r.stop
+	r.mu.Unlock()
+
+	log.Printf("scheduler is running")
+
+	next := now().Truncate(time.Minute).Add(time.Minute)
+	timer := time.NewTimer(next.Sub(now()))
+	for {
+		select {
+		case <-timer.C:
+			r.run(next)
+			next = next.Add(time.Minute)
+			timer = time.NewTimer(next.Sub(now()))
+		case <-stop:
+			timer.Stop()
+			log.Printf("scheduler stopped")
+			return
+		}
+	}
+}
+
+// Stop stops the scheduling loop. It does not wait for
+// the loop to return.
+func (r *Runner) Stop() {
+	r.mu.Lock()
+	if !r.running {
+		r.mu.Unlock()
+		return
+	}
+	r.running = false
+	stop := r.stop
+	r.mu.Unlock()
+	close(stop)
+}
+
+func (r *Runner) run(t time.Time) {
+	// entries are read just before t so that jobs
+	// scheduled exactly at t are included.
+	entries, err := r.EntryReader.Read(t.Add(-time.Second))
+	if err != nil {
+		log.Printf("failed to read entries: %v", err)
+		return
+	}
+	for _, e := range entries {
+		if e.Next.After(t) {
+			continue
+		}
+		go func(e *Entry) {
+			log.Printf("start scheduled job: %s", e.Job)
+			if err := e.Job.Run(); err != nil {
+				log.Printf("failed to run scheduled job %s: %v", e.Job, err)
+			}
+		}(e)
+	}
+}
+
+var now = time.Now
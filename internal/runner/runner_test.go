@@ -0,0 +1,138 @@
+package runner
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRun(t *testing.T) {
+	tm := time.Date(2022, 5, 1, 10, 0, 0, 0, time.Local)
+	due, notDue := &mockJob{}, &mockJob{}
+	r := NewWithConfig(&Config{
+		EntryReader: &mockEntryReader{
+			Entries: []*Entry{
+				{Next: tm, Job: due},
+				{Next: tm.Add(time.Minute), Job: notDue},
+			},
+		},
+	})
+
+	r.run(tm)
+
+	require.Eventually(t, func() bool {
+		return due.RunCount() == 1
+	}, time.Second, time.Millisecond*10)
+	require.Equal(t, 0, notDue.RunCount())
+}
+
+func TestStartStop(t *testing.T) {
+	tm := time.Date(2022, 5, 1, 9, 59, 59, 900_000_000, time.Local)
+	origNow := now
+	now = func() time.Time { return tm }
+	defer func() { now = origNow }()
+
+	j := &mockJob{}
+	r := NewWithConfig(&Config{
+		EntryReader: &mockEntryReader{
+			Entries: []*Entry{
+				{Next: tm.Add(time.Millisecond * 100), Job: j},
+			},
+		},
+	})
+
+	done := make(chan struct{})
+	go func() {
+		r.Start()
+		close(done)
+	}()
+
+	require.Eventually(t, func() bool {
+		return j.RunCount() == 1
+	}, time.Second, time.Millisecond*10)
+
+	r.Stop()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("scheduler did not stop")
+	}
+}
+
+func TestStopWhileRunning(t *testing.T) {
+	tm := time.Date(2022, 5, 1, 9, 59, 59, 900_000_000, time.Local)
+	origNow := now
+	now = func() time.Time { return tm }
+	defer func() { now = origNow }()
+
+	er := &mockEntryReader{Block: make(chan struct{})}
+	r := NewWithConfig(&Config{EntryReader: er})
+
+	done := make(chan struct{})
+	go func() {
+		r.Start()
+		close(done)
+	}()
+
+	// the loop is reading the entries and not waiting for Stop
+	time.Sleep(time.Millisecond * 300)
+
+	stopped := make(chan struct{})
+	go func() {
+		r.Stop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("Stop blocked")
+	}
+
+	close(er.Block)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("scheduler did not stop")
+	}
+}
+
+type mockEntryReader struct {
+	Entries []*Entry
+	// Block blocks Read until it is closed if not nil.
+	Block chan struct{}
+}
+
+var _ EntryReader = (*mockEntryReader)(nil)
+
+func (er *mockEntryReader) Read(t time.Time) ([]*Entry, error) {
+	if er.Block != nil {
+		<-er.Block
+	}
+	return er.Entries, nil
+}
+
+type mockJob struct {
+	mu       sync.Mutex
+	runCount int
+}
+
+var _ Job = (*mockJob)(nil)
+
+func (j *mockJob) Run() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.runCount++
+	return nil
+}
+
+func (j *mockJob) String() string {
+	return "mock job"
+}
+
+func (j *mockJob) RunCount() int {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.runCount
+}
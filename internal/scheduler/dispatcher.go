@@ -0,0 +1,473 @@
+package scheduler
+
+import (
+	"container/heap"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/yohamta/dagu/internal/config"
+	"github.com/yohamta/dagu/internal/pool"
+)
+
+// dispatcher runs the nodes of a graph for Schedule. Instead of
+// polling the graph, it keeps the in-degree of each node, that is
+// the number of its upstream nodes not finished yet, and puts the
+// node in the ready queue when it becomes zero. The loop waits for
+// the events of the nodes finishing, the timers for the retries and
+// the delay between the nodes, the timeout, and the cancellation.
+type dispatcher struct {
+	sc       *Scheduler
+	g        *ExecutionGraph
+	done     chan *Node
+	events   chan *Node
+	ready    readyQueue
+	indegree map[int]int
+	resolved map[int]bool
+	// retries are the nodes failed and waiting to be retried.
+	retries map[int]*Node
+	// queued are the nodes waiting for a slot of their pool. They
+	// do not take the slots of MaxActiveRuns while waiting.
+	queued map[int]*Node
+	// remaining is the number of the children not finished
+	// for each of the running foreach nodes.
+	remaining map[int]int
+	// parallel is the number of the running children for
+	// each of the foreach nodes.
+	parallel map[int]int
+	running  int
+	// slots is the number of the slots of MaxActiveRuns taken
+	// by the running nodes, the sum of their weights.
+	slots     int
+	lastStart time.Time
+	timedOut  bool
+}
+
+func newDispatcher(sc *Scheduler, g *ExecutionGraph, done chan *Node) *dispatcher {
+	d := &dispatcher{
+		sc:        sc,
+		g:         g,
+		done:      done,
+		events:    make(chan *Node),
+		indegree:  map[int]int{},
+		resolved:  map[int]bool{},
+		retries:   map[int]*Node{},
+		queued:    map[int]*Node{},
+		remaining: map[int]int{},
+		parallel:  map[int]int{},
+	}
+	nodes := g.Nodes()
+	for _, node := range nodes {
+		d.indegree[node.id] = len(g.To(node.id))
+	}
+	// the nodes finished before, such as the ones not to retry
+	for _, node := range nodes {
+		if isFinished(node.ReadStatus()) {
+			d.resolve(node)
+		}
+	}
+	for _, node := range nodes {
+		if len(g.To(node.id)) == 0 && node.ReadStatus() == NodeStatusNone {
+			heap.Push(&d.ready, node)
+		}
+	}
+	return d
+}
+
+// run runs the nodes until all of them finish, or the scheduler is
+// canceled or timed out and the running nodes finish.
+func (d *dispatcher) run() {
+	canceled := d.sc.canceledChan()
+	resumed := d.sc.resumedChan()
+	for {
+		if !d.stopped() && d.sc.isTimedOut() {
+			log.Printf("%s", d.sc.timeoutError())
+			d.sc.setLastError(d.sc.timeoutError())
+			d.timedOut = true
+		}
+		if !d.stopped() && !d.sc.IsPaused() {
+			d.dispatch()
+		}
+		if d.running == 0 && (d.stopped() || d.idle()) {
+			d.dequeue()
+			return
+		}
+		if d.stopped() {
+			canceled = nil
+		}
+		var timer *time.Timer
+		var wakeup <-chan time.Time
+		if t, ok := d.nextWakeup(); ok {
+			timer = time.NewTimer(time.Until(t))
+			wakeup = timer.C
+		}
+		select {
+		case node := <-d.events:
+			d.finish(node)
+		case <-wakeup:
+		case <-canceled:
+		case <-resumed:
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+	}
+}
+
+func (d *dispatcher) stopped() bool {
+	return d.timedOut || d.sc.IsCanceled()
+}
+
+// idle returns true if no node is ready, waiting to be retried,
+// or waiting for a slot of its pool.
+func (d *dispatcher) idle() bool {
+	return d.ready.Len() == 0 && len(d.retries) == 0 && len(d.queued) == 0
+}
+
+// dequeue gives up the nodes waiting for a slot of their pool
+// when the scheduler is stopped.
+func (d *dispatcher) dequeue() {
+	for id, node := range d.queued {
+		delete(d.queued, id)
+		node.setQueued("")
+		if d.sc.IsCanceled() && node.ReadStatus() == NodeStatusNone {
+			node.updateStatus(NodeStatusCancel)
+		}
+	}
+}
+
+// nextWakeup returns the time when a node can be started next
+// without an event: a retry, the end of the delay, the next try
+// to take a slot of a pool, or the timeout.
+// While the scheduler is paused, only the timeout wakes it up.
+func (d *dispatcher) nextWakeup() (t time.Time, ok bool) {
+	next := func(v time.Time) {
+		if !ok || v.Before(t) {
+			t, ok = v, true
+		}
+	}
+	if d.stopped() {
+		return
+	}
+	if !d.sc.deadline.IsZero() {
+		next(d.sc.deadline)
+	}
+	if d.sc.IsPaused() {
+		return
+	}
+	for _, node := range d.retries {
+		next(node.readRetryAt())
+	}
+	if len(d.queued) > 0 {
+		next(time.Now().Add(d.sc.pause))
+	}
+	if d.ready.Len() > 0 && d.sc.Delay > 0 && !d.lastStart.IsZero() {
+		next(d.lastStart.Add(d.sc.Delay))
+	}
+	return
+}
+
+// dispatch starts the ready nodes as many as allowed. The node with
+// the highest priority goes first; when it does not fit in the free
+// slots, the nodes behind it wait too, so that a heavy node is not
+// kept waiting by lighter ones forever. A node that can not take a
+// slot of its pool does not hold back the others and is tried again
+// on the next dispatch.
+func (d *dispatcher) dispatch() {
+	for id, node := range d.retries {
+		if node.readyToRetry() {
+			delete(d.retries, id)
+			heap.Push(&d.ready, node)
+		}
+	}
+	for id, node := range d.queued {
+		delete(d.queued, id)
+		heap.Push(&d.ready, node)
+	}
+	var blocked []*Node
+	for d.ready.Len() > 0 {
+		if d.sc.Delay > 0 && !d.lastStart.IsZero() &&
+			time.Now().Before(d.lastStart.Add(d.sc.Delay)) {
+			break
+		}
+		node := d.ready[0]
+		if node.ReadStatus() != NodeStatusNone {
+			// canceled before it started
+			heap.Pop(&d.ready)
+			continue
+		}
+		if !d.fits(node) {
+			break
+		}
+		heap.Pop(&d.ready)
+		if p := d.g.parent(node); p != nil && p.MaxParallel > 0 &&
+			d.parallel[p.id] >= p.MaxParallel {
+			blocked = append(blocked, node)
+			continue
+		}
+		slot, ok := d.acquireSlot(node)
+		if !ok {
+			continue
+		}
+		d.start(node, slot)
+	}
+	for _, node := range blocked {
+		heap.Push(&d.ready, node)
+	}
+}
+
+// fits returns true if the node can take its slots of MaxActiveRuns.
+// A node heavier than MaxActiveRuns runs when no other node runs.
+func (d *dispatcher) fits(node *Node) bool {
+	if d.sc.MaxActiveRuns <= 0 || node.IsForeach() {
+		return true
+	}
+	return d.slots == 0 || d.slots+node.Slots() <= d.sc.MaxActiveRuns
+}
+
+// start runs the node with the slot of its pool, if any.
+func (d *dispatcher) start(node *Node, slot *pool.Slot) {
+	sc := d.sc
+	node.setOutputs(d.g.upstreamOutputs(node))
+	if len(node.Preconditions) > 0 {
+		log.Printf("checking pre conditions for \"%s\"", node.Name)
+		results, err := config.CheckConditions(node.preconditions(), node.variables())
+		node.ConditionResults = results
+		if err != nil {
+			if slot != nil {
+				slot.Release()
+			}
+			node.Error = err
+			node.redact()
+			log.Printf("%s", node.Error)
+			node.updateStatus(NodeStatusSkipped)
+			d.resolve(node)
+			return
+		}
+		node.redact()
+	}
+	if node.IsForeach() {
+		items := node.foreachItems()
+		log.Printf("expanding %s for %d items", node.Name, len(items))
+		node.StartedAt = time.Now()
+		node.updateStatus(NodeStatusRunning)
+		children := d.g.expand(node, items)
+		d.remaining[node.id] = len(children)
+		for _, c := range children {
+			d.indegree[c.id] = 0
+			heap.Push(&d.ready, c)
+		}
+		if len(children) == 0 {
+			d.finishForeach(node)
+		}
+		return
+	}
+	if !sc.deadline.IsZero() {
+		node.setDeadline(sc.deadline, sc.timeoutError())
+	}
+	log.Printf("start running: %s", node.Name)
+	node.updateStatus(NodeStatusRunning)
+	d.running++
+	d.slots += node.Slots()
+	if p := d.g.parent(node); p != nil {
+		d.parallel[p.id]++
+	}
+	d.lastStart = time.Now()
+	go d.execute(node, slot)
+}
+
+// execute runs the node, repeating and retrying it as configured,
+// and sends the event when it finishes. The slot of the pool is
+// released at the end.
+func (d *dispatcher) execute(node *Node, slot *pool.Slot) {
+	sc := d.sc
+	defer func() {
+		node.FinishedAt = time.Now()
+		d.events <- node
+	}()
+	if slot != nil {
+		defer slot.Release()
+	}
+
+	if !sc.Dry {
+		node.setupLog(sc.LogDir, sc.RequestId)
+		node.setRunEnv(sc.runEnv(node))
+		node.openLogFile()
+		defer node.closeLogFile()
+	}
+
+	for !sc.IsCanceled() {
+		var err error = nil
+		if !sc.Dry {
+			err = node.Execute()
+		}
+		if err != nil {
+			handleError(node)
+			switch node.ReadStatus() {
+			case NodeStatusNone:
+				// nothing to do
+			case NodeStatusError:
+				sc.setLastError(err)
+			}
+		}
+		if node.ReadStatus() != NodeStatusCancel {
+			node.incDoneCount()
+		}
+		if node.RepeatPolicy.Repeat {
+			if err == nil || node.ContinueOn.Failure {
+				if !sc.IsCanceled() && !sc.isTimedOut() {
+					time.Sleep(node.RepeatPolicy.Interval)
+					continue
+				}
+			}
+		}
+		if err != nil {
+			if d.done != nil {
+				d.done <- node
+			}
+			return
+		}
+		break
+	}
+	if node.ReadStatus() == NodeStatusRunning {
+		node.updateStatus(NodeStatusSuccess)
+	}
+	if d.done != nil {
+		d.done <- node
+	}
+}
+
+// acquireSlot takes a slot of the pool of the node without waiting.
+// It returns false when the node can not start now: the node is
+// queued if all the slots are taken, and fails if the pool is not
+// available. The foreach nodes take slots for each of the children.
+func (d *dispatcher) acquireSlot(node *Node) (*pool.Slot, bool) {
+	sc := d.sc
+	if node.Pool == "" || sc.Dry || node.IsForeach() {
+		return nil, true
+	}
+	slot, err := sc.tryAcquireSlot(node)
+	if err != nil {
+		node.setQueued("")
+		node.Error = err
+		node.updateStatus(NodeStatusError)
+		sc.setLastError(err)
+		if d.done != nil {
+			d.done <- node
+		}
+		d.resolve(node)
+		return nil, false
+	}
+	if slot == nil {
+		d.queued[node.id] = node
+		return nil, false
+	}
+	return slot, true
+}
+
+// finish handles the event of the node finished.
+func (d *dispatcher) finish(node *Node) {
+	d.running--
+	d.slots -= node.Slots()
+	if p := d.g.parent(node); p != nil {
+		d.parallel[p.id]--
+	}
+	if node.ReadStatus() == NodeStatusNone {
+		d.retries[node.id] = node
+		return
+	}
+	d.resolve(node)
+}
+
+// resolve updates the downstream nodes of the finished node. A node
+// is ready when all of its upstream nodes succeeded, or failed or
+// were skipped with continueOn. Otherwise, it is canceled or skipped
+// without running, and so are its downstream nodes.
+func (d *dispatcher) resolve(node *Node) {
+	if d.resolved[node.id] {
+		return
+	}
+	d.resolved[node.id] = true
+	if p := d.g.parent(node); p != nil && p.ReadStatus() == NodeStatusRunning {
+		d.remaining[p.id]--
+		if d.remaining[p.id] <= 0 {
+			d.finishForeach(p)
+		}
+	}
+	status := node.ReadStatus()
+	for _, id := range d.g.From(node.id) {
+		v := d.g.Node(id)
+		if d.resolved[id] || v.ReadStatus() != NodeStatusNone {
+			continue
+		}
+		switch {
+		case status == NodeStatusSuccess,
+			status == NodeStatusError && node.ContinueOn.Failure,
+			status == NodeStatusSkipped && node.ContinueOn.Skipped:
+			d.indegree[id]--
+			if d.indegree[id] == 0 {
+				heap.Push(&d.ready, v)
+			}
+			continue
+		case status == NodeStatusError:
+			v.updateStatus(NodeStatusCancel)
+			v.Error = fmt.Errorf("upstream failed")
+		case status == NodeStatusSkipped:
+			v.updateStatus(NodeStatusSkipped)
+			v.Error = fmt.Errorf("upstream skipped")
+		default:
+			v.updateStatus(NodeStatusCancel)
+		}
+		d.resolve(v)
+	}
+}
+
+// finishForeach finishes the foreach node whose children have all
+// finished and resolves its downstream nodes.
+func (d *dispatcher) finishForeach(node *Node) {
+	delete(d.remaining, node.id)
+	if !d.sc.finishForeachNode(d.g, node) {
+		return
+	}
+	if d.done != nil {
+		d.done <- node
+	}
+	d.resolve(node)
+}
+
+// isFinished returns true if the node will not run anymore.
+func isFinished(status NodeStatus) bool {
+	switch status {
+	case NodeStatusSuccess, NodeStatusError, NodeStatusCancel, NodeStatusSkipped:
+		return true
+	}
+	return false
+}
+
+// readyQueue is the queue of the nodes ready to run. The nodes are
+// started in the order of their priority, and in the order they are
+// defined among the ones of the same priority.
+type readyQueue []*Node
+
+var _ heap.Interface = (*readyQueue)(nil)
+
+func (q readyQueue) Len() int { return len(q) }
+
+func (q readyQueue) Less(i, j int) bool {
+	if q[i].Priority != q[j].Priority {
+		return q[i].Priority > q[j].Priority
+	}
+	return q[i].id < q[j].id
+}
+
+func (q readyQueue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+
+func (q *readyQueue) Push(x interface{}) { *q = append(*q, x.(*Node)) }
+
+func (q *readyQueue) Pop() interface{} {
+	old := *q
+	n := old[len(old)-1]
+	old[len(old)-1] = nil
+	*q = old[:len(old)-1]
+	return n
+}
@@ -0,0 +1,147 @@
+package scheduler_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/yohamta/dagu/internal/config"
+	"github.com/yohamta/dagu/internal/scheduler"
+)
+
+func TestSchedulerOrder(t *testing.T) {
+	g, sc := newTestSchedule(t,
+		&scheduler.Config{MaxActiveRuns: 1, Dry: true},
+		step("1", testCommand),
+		step("2", testCommand, "1"),
+		step("3", testCommand),
+		step("4", testCommand, "1", "3"),
+		step("5", testCommand),
+	)
+
+	done := make(chan *scheduler.Node)
+	finished := make(chan []string)
+	go func() {
+		var names []string
+		for n := range done {
+			names = append(names, n.Name)
+		}
+		finished <- names
+	}()
+	require.NoError(t, sc.Schedule(g, done))
+	close(done)
+
+	// the ready steps run in the order they are defined
+	require.Equal(t, []string{"1", "2", "3", "4", "5"}, <-finished)
+}
+
+func TestSchedulerPriority(t *testing.T) {
+	s2 := step("2", testCommand)
+	s2.Priority = 1
+	s4 := step("4", testCommand, "1")
+	s4.Priority = 2
+	g, sc := newTestSchedule(t,
+		&scheduler.Config{MaxActiveRuns: 1, Dry: true},
+		step("1", testCommand),
+		s2,
+		step("3", testCommand),
+		s4,
+	)
+
+	done := make(chan *scheduler.Node)
+	finished := make(chan []string)
+	go func() {
+		var names []string
+		for n := range done {
+			names = append(names, n.Name)
+		}
+		finished <- names
+	}()
+	require.NoError(t, sc.Schedule(g, done))
+	close(done)
+
+	// 4 goes before 3 once it is ready
+	require.Equal(t, []string{"2", "1", "4", "3"}, <-finished)
+}
+
+func TestSchedulerWeight(t *testing.T) {
+	heavy := step("heavy", "sleep 0.3")
+	heavy.Weight = 2
+	heavy.Priority = 1
+	huge := step("huge", "sleep 0.3", "heavy")
+	huge.Weight = 5
+	g, sc := newTestSchedule(t,
+		&scheduler.Config{MaxActiveRuns: 2},
+		heavy,
+		step("a", "sleep 0.3"),
+		step("b", "sleep 0.3"),
+		huge,
+	)
+	require.NoError(t, sc.Schedule(g, nil))
+	require.Equal(t, scheduler.SchedulerStatus_Success, sc.Status(g))
+
+	nodes := map[string]*scheduler.Node{}
+	for _, n := range g.Nodes() {
+		nodes[n.Name] = n
+	}
+	overlap := func(x, y string) bool {
+		a, b := nodes[x], nodes[y]
+		return a.StartedAt.Before(b.FinishedAt) && b.StartedAt.Before(a.FinishedAt)
+	}
+	// the heavy step takes both slots, and the light steps run together
+	require.False(t, overlap("heavy", "a"))
+	require.False(t, overlap("heavy", "b"))
+	require.True(t, overlap("a", "b"))
+	// the step heavier than maxActiveRuns runs alone
+	require.False(t, overlap("huge", "a"))
+	require.False(t, overlap("huge", "b"))
+}
+
+// layeredSteps returns the steps of a graph of n nodes in layers of
+// the width. Each step depends on two steps of the previous layer.
+func layeredSteps(n, width int) []*config.Step {
+	var ret []*config.Step
+	for i := 0; i < n; i++ {
+		s := &config.Step{
+			Name:    fmt.Sprintf("%d", i),
+			Command: testCommand,
+		}
+		if layer := i / width; layer > 0 {
+			prev := (layer - 1) * width
+			s.Depends = []string{
+				fmt.Sprintf("%d", prev+i%width),
+				fmt.Sprintf("%d", prev+(i+1)%width),
+			}
+		}
+		ret = append(ret, s)
+	}
+	return ret
+}
+
+func benchmarkSchedule(b *testing.B, n int) {
+	log.SetOutput(ioutil.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	steps := layeredSteps(n, 100)
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		g, err := scheduler.NewExecutionGraph(steps...)
+		require.NoError(b, err)
+		sc := scheduler.New(&scheduler.Config{Dry: true})
+		b.StartTimer()
+
+		require.NoError(b, sc.Schedule(g, nil))
+		require.Equal(b, scheduler.SchedulerStatus_Success, sc.Status(g))
+	}
+}
+
+func BenchmarkSchedule1k(b *testing.B) {
+	benchmarkSchedule(b, 1000)
+}
+
+func BenchmarkSchedule10k(b *testing.B) {
+	benchmarkSchedule(b, 10000)
+}
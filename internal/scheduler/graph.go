@@ -3,6 +3,7 @@ package scheduler
 import (
 	"fmt"
 	"log"
+	"sync"
 	"time"
 
 	"github.com/yohamta/dagu/internal/config"
@@ -13,21 +14,33 @@ type ExecutionGraph struct {
 	nodes                 []*Node
 	from                  map[int][]int
 	to                    map[int][]int
+	children              map[int][]int
+	names                 map[string]int
+	hasOutputs            bool
+	mu                    sync.RWMutex
 	StartedAt, FinishedAt time.Time
 }
 
 func NewExecutionGraph(steps ...*config.Step) (*ExecutionGraph, error) {
+	var nodes []*Node
+	for _, step := range steps {
+		nodes = append(nodes, &Node{Step: step})
+	}
+	return newExecutionGraph(nodes...)
+}
+
+func newExecutionGraph(nodes ...*Node) (*ExecutionGraph, error) {
 	graph := &ExecutionGraph{
-		dict:  make(map[int]*Node),
-		from:  make(map[int][]int),
-		to:    make(map[int][]int),
-		nodes: []*Node{},
+		dict:     make(map[int]*Node),
+		from:     make(map[int][]int),
+		to:       make(map[int][]int),
+		children: make(map[int][]int),
+		names:    make(map[string]int),
+		nodes:    []*Node{},
 	}
-	for _, step := range steps {
-		node := &Node{Step: step}
+	for _, node := range nodes {
 		node.init()
-		graph.dict[node.id] = node
-		graph.nodes = append(graph.nodes, node)
+		graph.add(node)
 	}
 	if err := graph.setup(); err != nil {
 		return nil, err
@@ -36,24 +49,25 @@ func NewExecutionGraph(steps ...*config.Step) (*ExecutionGraph, error) {
 }
 
 func RetryExecutionGraph(nodes ...*Node) (*ExecutionGraph, error) {
-	graph := &ExecutionGraph{
-		dict:  make(map[int]*Node),
-		from:  make(map[int][]int),
-		to:    make(map[int][]int),
-		nodes: []*Node{},
-	}
-	for _, node := range nodes {
-		node.init()
-		graph.dict[node.id] = node
-		graph.nodes = append(graph.nodes, node)
-	}
-	if err := graph.setup(); err != nil {
+	graph, err := newExecutionGraph(nodes...)
+	if err != nil {
 		return nil, err
 	}
 	if err := graph.setupRetry(); err != nil {
 		return nil, err
 	}
-	return graph, nil
+	// the foreach steps to retry are expanded again
+	var retained []*Node
+	for _, node := range graph.nodes {
+		if p := graph.parent(node); p != nil && p.Status == NodeStatusNone {
+			continue
+		}
+		retained = append(retained, node)
+	}
+	if len(retained) == len(graph.nodes) {
+		return graph, nil
+	}
+	return newExecutionGraph(retained...)
 }
 
 func (g *ExecutionGraph) Duration() time.Duration {
@@ -64,6 +78,8 @@ func (g *ExecutionGraph) Duration() time.Duration {
 }
 
 func (g *ExecutionGraph) Nodes() []*Node {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
 	return g.nodes
 }
 
@@ -76,9 +92,116 @@ func (g *ExecutionGraph) To(to int) []int {
 }
 
 func (g *ExecutionGraph) Node(id int) *Node {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
 	return g.dict[id]
 }
 
+// expand adds a child node for each item of the foreach node.
+// The children depend on the upstream nodes of the foreach node,
+// and the foreach node finishes when all the children finish.
+func (g *ExecutionGraph) expand(node *Node, items []string) []*Node {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	var ret []*Node
+	for _, item := range items {
+		step := *node.Step
+		step.Name = fmt.Sprintf("%s[%s]", node.Name, item)
+		step.Foreach = nil
+		step.ForeachFrom = ""
+		step.MaxParallel = 0
+		step.Parent = node.Name
+		step.Item = item
+		child := &Node{Step: &step}
+		child.init()
+		g.add(child)
+		for _, u := range g.to[node.id] {
+			g.from[u] = append(g.from[u], child.id)
+			g.to[child.id] = append(g.to[child.id], u)
+		}
+		g.children[node.id] = append(g.children[node.id], child.id)
+		ret = append(ret, child)
+	}
+	return ret
+}
+
+func (g *ExecutionGraph) add(node *Node) {
+	g.dict[node.id] = node
+	g.nodes = append(g.nodes, node)
+	g.names[node.Name] = node.id
+	if node.Output != "" {
+		g.hasOutputs = true
+	}
+}
+
+// Children returns the nodes expanded from the foreach node.
+func (g *ExecutionGraph) Children(node *Node) []*Node {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	var ret []*Node
+	for _, id := range g.children[node.id] {
+		ret = append(ret, g.dict[id])
+	}
+	return ret
+}
+
+// parent returns the foreach node the node was expanded from.
+func (g *ExecutionGraph) parent(node *Node) *Node {
+	if node.Parent == "" {
+		return nil
+	}
+	p, err := g.findStep(node.Parent)
+	if err != nil {
+		return nil
+	}
+	return p
+}
+
+// upstreamOutputs returns the output variables of all the steps
+// that the node depends on directly or indirectly.
+func (g *ExecutionGraph) upstreamOutputs(node *Node) map[string]string {
+	ret := map[string]string{}
+	if node.Parent != "" {
+		ret[config.ItemVariable] = node.Item
+	}
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	if !g.hasOutputs {
+		return ret
+	}
+	visited := map[int]bool{}
+	frontier := g.to[node.id]
+	for len(frontier) > 0 {
+		var next []int
+		for _, u := range frontier {
+			if visited[u] {
+				continue
+			}
+			visited[u] = true
+			n := g.dict[u]
+			if n.Output != "" {
+				if _, ok := ret[n.Output]; !ok {
+					ret[n.Output] = n.OutputValue
+				}
+			}
+			next = append(next, g.to[u]...)
+		}
+		frontier = next
+	}
+	return ret
+}
+
+// outputs returns the output variables of all the steps.
+func (g *ExecutionGraph) outputs() map[string]string {
+	ret := map[string]string{}
+	for _, n := range g.nodes {
+		if n.Output != "" {
+			ret[n.Output] = n.OutputValue
+		}
+	}
+	return ret
+}
+
 func (g *ExecutionGraph) setupRetry() error {
 	dict := map[int]NodeStatus{}
 	retry := map[int]bool{}
@@ -114,6 +237,9 @@ func (g *ExecutionGraph) setupRetry() error {
 
 func (g *ExecutionGraph) setup() error {
 	for _, node := range g.nodes {
+		if p := g.parent(node); p != nil {
+			g.children[p.id] = append(g.children[p.id], node.id)
+		}
 		for _, dep := range node.Depends {
 			depStep, err := g.findStep(dep)
 			if err != nil {
@@ -149,10 +275,8 @@ func (g *ExecutionGraph) cycleDfs(t int, visited map[int]bool) error {
 }
 
 func (g *ExecutionGraph) findStep(name string) (*Node, error) {
-	for _, n := range g.dict {
-		if n.Name == name {
-			return n, nil
-		}
+	if id, ok := g.names[name]; ok {
+		return g.dict[id], nil
 	}
 	return nil, fmt.Errorf("step not found: %s", name)
 }
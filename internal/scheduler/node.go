@@ -2,15 +2,23 @@ package scheduler
 
 import (
 	"bufio"
+	"bytes"
 	"context"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strings"
 	"sync"
+	"syscall"
 	"time"
 
+	"github.com/segmentio/ksuid"
 	"github.com/yohamta/dagu/internal/config"
+	"github.com/yohamta/dagu/internal/settings"
 	"github.com/yohamta/dagu/internal/utils"
 )
 
@@ -50,41 +58,430 @@ type Node struct {
 	id         int
 	mu         sync.RWMutex
 	cmd        *exec.Cmd
+	pid        int
 	cancelFunc func()
 	logFile    *os.File
 	logWriter  *bufio.Writer
+	outputs    map[string]string
+	deadline   time.Time
+	timeoutErr error
+	retryAt    time.Time
+	runEnv     []string
+	// queued is the name of the pool the node is waiting for.
+	queued string
 }
 
 type NodeState struct {
-	Status     NodeStatus
-	Log        string
-	StartedAt  time.Time
-	FinishedAt time.Time
-	RetryCount int
-	DoneCount  int
-	Error      error
+	Status           NodeStatus
+	Log              string
+	StartedAt        time.Time
+	FinishedAt       time.Time
+	RetryCount       int
+	DoneCount        int
+	Error            error
+	SubRequestId     string
+	OutputValue      string
+	ExitCode         int
+	Attempts         []Attempt
+	ConditionResults []*config.ConditionResult
+	// ForceKilled is true when the step was killed with SIGKILL
+	// because it did not stop within the grace period.
+	ForceKilled bool
+}
+
+// Attempt records an execution of a step with a retry policy.
+type Attempt struct {
+	StartedAt time.Time
+	ExitCode  int
 }
 
 func (n *Node) Execute() error {
-	ctx, fn := context.WithCancel(context.Background())
+	ctx, fn, timeoutErr := n.context()
+	defer fn()
 	n.cancelFunc = fn
-	cmd := exec.CommandContext(ctx, n.Command, n.Args...)
+	var cmd *exec.Cmd
+	switch {
+	case n.Run != "":
+		cmd = n.subDAGCommand()
+	case n.Script != "":
+		var err error
+		var script string
+		cmd, script, err = n.scriptCommand()
+		if err != nil {
+			n.Error = err
+			return err
+		}
+		defer os.Remove(script)
+	default:
+		args := make([]string, len(n.Args))
+		for i, arg := range n.Args {
+			args[i] = n.expand(arg)
+		}
+		cmd = exec.Command(n.expand(n.Command), args...)
+	}
 	n.cmd = cmd
-	cmd.Dir = n.Dir
-	cmd.Env = append(cmd.Env, n.Variables...)
+	cmd.Dir = n.expand(n.Dir)
+	cmd.Env = append(cmd.Env, n.InheritEnv.Filter(os.Environ())...)
+	cmd.Env = append(cmd.Env, n.variables()...)
+	cmd.Env = append(cmd.Env, n.Secrets...)
+	for k, v := range n.outputs {
+		cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", k, v))
+	}
+	cmd.Env = append(cmd.Env, n.runEnv...)
 
+	var w io.Writer = os.Stdout
 	if n.logWriter != nil {
-		cmd.Stdout = n.logWriter
-		cmd.Stderr = n.logWriter
+		w = n.logWriter
+	}
+	if len(n.Secrets) > 0 {
+		rw := &redactWriter{w: w, secrets: n.Secrets}
+		defer rw.Flush()
+		w = rw
+	}
+	var out *bytes.Buffer
+	if n.Output != "" {
+		out = &bytes.Buffer{}
+		w = &syncWriter{w: w}
+		cmd.Stdout = io.MultiWriter(w, out)
 	} else {
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stdout
+		cmd.Stdout = w
 	}
+	cmd.Stderr = w
 
-	n.Error = cmd.Run()
+	startedAt := time.Now()
+	n.Error = n.run(ctx, cmd)
+	n.ExitCode = exitCode(n.Error)
+	if n.RetryPolicy != nil {
+		n.Attempts = append(n.Attempts, Attempt{
+			StartedAt: startedAt,
+			ExitCode:  n.ExitCode,
+		})
+	}
+	if n.Error != nil && ctx.Err() == context.DeadlineExceeded {
+		n.Error = timeoutErr
+	}
+	if n.readForceKilled() {
+		n.Error = errForceKilled
+	}
+	if out != nil {
+		n.OutputValue = strings.TrimSpace(out.String())
+	}
+	n.redact()
 	return n.Error
 }
 
+var errForceKilled = fmt.Errorf("killed by SIGKILL after the grace period to stop")
+
+// run starts the command in its own process group so that
+// the signals are sent to all the processes of the step,
+// and waits for it to exit. When the context is done, the
+// process group is killed, so that no descendant process
+// outlives a canceled or timed out step. A sub DAG is sent
+// SIGTERM instead to let its agent stop its own steps.
+func (n *Node) run(ctx context.Context, cmd *exec.Cmd) error {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	n.mu.Lock()
+	n.pid = cmd.Process.Pid
+	n.mu.Unlock()
+	sig := syscall.SIGKILL
+	if n.Run != "" {
+		sig = syscall.SIGTERM
+	}
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			n.signalGroup(sig)
+		case <-done:
+		}
+	}()
+	err := cmd.Wait()
+	close(done)
+	n.mu.Lock()
+	n.pid = 0
+	n.mu.Unlock()
+	return err
+}
+
+// signalGroup sends the signal to the process group
+// of the step if it is running.
+func (n *Node) signalGroup(sig syscall.Signal) {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	if n.pid != 0 {
+		syscall.Kill(-n.pid, sig)
+	}
+}
+
+// exitCode returns the exit code of the command.
+// It returns -1 when the command was not started or
+// was terminated by a signal.
+func exitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		return exitErr.ExitCode()
+	}
+	return -1
+}
+
+// context returns the context to run the step with.
+// The deadline is the earlier of the step timeout and the
+// deadline set by the scheduler for the DAG timeout. The returned
+// error describes which of them is applied.
+func (n *Node) context() (context.Context, context.CancelFunc, error) {
+	deadline, err := n.deadline, n.timeoutErr
+	if n.Timeout > 0 {
+		d := time.Now().Add(n.Timeout)
+		if deadline.IsZero() || d.Before(deadline) {
+			deadline = d
+			err = fmt.Errorf("step timed out after %s", n.Timeout)
+		}
+	}
+	if deadline.IsZero() {
+		ctx, fn := context.WithCancel(context.Background())
+		return ctx, fn, nil
+	}
+	ctx, fn := context.WithDeadline(context.Background(), deadline)
+	return ctx, fn, err
+}
+
+func (n *Node) setDeadline(deadline time.Time, err error) {
+	n.deadline = deadline
+	n.timeoutErr = err
+}
+
+// preconditions returns the preconditions of the step with
+// the output variables of the upstream steps expanded.
+// variables returns the variables of the step with the references
+// to the secrets expanded. The variables of the DAG and the named
+// parameters passed from the parent DAG may refer to the secrets.
+func (n *Node) variables() []string {
+	ret := make([]string, len(n.Variables))
+	for i, v := range n.Variables {
+		if strings.Contains(v, "${"+config.SecretRefPrefix) {
+			v = n.expand(v)
+		}
+		ret[i] = v
+	}
+	return ret
+}
+
+func (n *Node) preconditions() []*config.Condition {
+	var ret []*config.Condition
+	for _, c := range n.Preconditions {
+		ret = append(ret, &config.Condition{
+			Condition:  n.expand(c.Condition),
+			Expected:   n.expand(c.Expected),
+			Operator:   c.Operator,
+			Command:    n.expand(c.Command),
+			FileExists: n.expand(c.FileExists),
+		})
+	}
+	return ret
+}
+
+// expand replaces the references to the output variables of
+// the upstream steps, the secrets and the variables of the run
+// context. Other variables have already been expanded when the
+// config was loaded, so the rest of the references are kept as
+// they are for the command to refer to its environment.
+func (n *Node) expand(s string) string {
+	if len(n.outputs) == 0 && len(n.Secrets) == 0 && len(n.runEnv) == 0 {
+		return s
+	}
+	return os.Expand(s, func(k string) string {
+		if v, ok := n.outputs[k]; ok {
+			return v
+		}
+		name := strings.TrimPrefix(k, config.SecretRefPrefix)
+		if v, ok := lookupVariable(n.Secrets, name); ok {
+			return v
+		}
+		if v, ok := lookupVariable(n.runEnv, k); ok {
+			return v
+		}
+		return fmt.Sprintf("${%s}", k)
+	})
+}
+
+// lookupVariable returns the value of the variable
+// in the list of NAME=VALUE.
+func lookupVariable(vars []string, name string) (string, bool) {
+	for _, v := range vars {
+		if strings.HasPrefix(v, name+"=") {
+			return v[len(name)+1:], true
+		}
+	}
+	return "", false
+}
+
+// redact replaces the secrets in the results of the preconditions
+// and the error so that they are not saved in the status.
+func (n *Node) redact() {
+	if len(n.Secrets) == 0 {
+		return
+	}
+	for _, r := range n.ConditionResults {
+		for _, s := range []*string{&r.Condition, &r.Expected, &r.Command,
+			&r.FileExists, &r.Actual, &r.Error} {
+			*s = config.Redact(*s, n.Secrets)
+		}
+	}
+	if n.Error != nil {
+		if msg := config.Redact(n.Error.Error(), n.Secrets); msg != n.Error.Error() {
+			n.Error = fmt.Errorf("%s", msg)
+		}
+	}
+}
+
+// foreachItems returns the items to expand the foreach step for.
+func (n *Node) foreachItems() []string {
+	items := n.Foreach
+	if len(items) == 0 {
+		items = strings.Fields(n.expand(n.ForeachFrom))
+	}
+	// the children are named after the items,
+	// so the duplicate items are run only once
+	var ret []string
+	seen := map[string]bool{}
+	for _, item := range items {
+		if !seen[item] {
+			seen[item] = true
+			ret = append(ret, item)
+		}
+	}
+	return ret
+}
+
+func (n *Node) setOutputs(outputs map[string]string) {
+	n.outputs = outputs
+}
+
+// syncWriter serializes the writes from stdout and stderr
+// when they are written through different writers.
+type syncWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (w *syncWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.w.Write(p)
+}
+
+// redactWriter replaces the values of the secrets in the output.
+// The output is written line by line so that a secret written
+// across multiple writes is redacted as well.
+type redactWriter struct {
+	w       io.Writer
+	secrets []string
+	buf     []byte
+}
+
+// maxRedactBuffer is the max size of a line to keep in the buffer.
+const maxRedactBuffer = 64 * 1024
+
+func (w *redactWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	i := bytes.LastIndexByte(w.buf, '\n')
+	if i < 0 {
+		if len(w.buf) < maxRedactBuffer {
+			return len(p), nil
+		}
+		i = len(w.buf) - 1
+	}
+	_, err := io.WriteString(w.w, config.Redact(string(w.buf[:i+1]), w.secrets))
+	w.buf = append(w.buf[:0], w.buf[i+1:]...)
+	return len(p), err
+}
+
+// Flush writes the rest of the output.
+func (w *redactWriter) Flush() error {
+	if len(w.buf) == 0 {
+		return nil
+	}
+	_, err := io.WriteString(w.w, config.Redact(string(w.buf), w.secrets))
+	w.buf = w.buf[:0]
+	return err
+}
+
+// defaultShell is used to run the script of the step
+// when no shell is specified.
+const defaultShell = "sh"
+
+// scriptCommand writes the script to a temporary file and
+// returns the command to run it through the shell with the
+// arguments of the script, and the path of the file.
+// The caller is responsible for removing the file.
+func (n *Node) scriptCommand() (*exec.Cmd, string, error) {
+	shell := n.Shell
+	if shell == "" {
+		shell = defaultShell
+	}
+	prog, args, err := utils.SplitCommandWith(shell, func(s string) string {
+		return utils.ExpandEnvWith(s, n.variables())
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	f, err := ioutil.TempFile("", "dagu_script-")
+	if err != nil {
+		return nil, "", err
+	}
+	defer f.Close()
+	if _, err = f.WriteString(n.Script); err != nil {
+		os.Remove(f.Name())
+		return nil, "", err
+	}
+	args = append(args, f.Name())
+	for _, arg := range n.ScriptArgs {
+		args = append(args, n.expand(arg))
+	}
+	return exec.Command(prog, args...), f.Name(), nil
+}
+
+// subDAGCommand returns the command to run the sub DAG
+// with a new request ID. The sub DAG is started as a separate
+// dagu process that inherits the environment of the agent
+// so that it shares the same data directory.
+func (n *Node) subDAGCommand() *exec.Cmd {
+	n.SubRequestId = ksuid.New().String()
+	args := []string{"start", fmt.Sprintf("--req=%s", n.SubRequestId)}
+	if n.Params != "" {
+		args = append(args, fmt.Sprintf("--params=%s", n.subDAGParams()))
+	}
+	args = append(args, n.Run)
+	cmd := exec.Command(settings.MustGet(settings.ConfigExecutable), args...)
+	cmd.Env = os.Environ()
+	return cmd
+}
+
+// subDAGParams expands the parameters of the sub DAG except the
+// secrets, which are passed as ${secret:NAME} references so that their
+// values are not shown in the command line or saved in the status of
+// the sub DAG. The sub DAG reads the values from its environment.
+func (n *Node) subDAGParams() string {
+	return os.Expand(n.Params, func(k string) string {
+		if v, ok := n.outputs[k]; ok {
+			return v
+		}
+		name := strings.TrimPrefix(k, config.SecretRefPrefix)
+		if _, ok := lookupVariable(n.Secrets, name); ok {
+			return fmt.Sprintf("${%s%s}", config.SecretRefPrefix, name)
+		}
+		if v, ok := lookupVariable(n.runEnv, k); ok {
+			return v
+		}
+		return fmt.Sprintf("${%s}", k)
+	})
+}
+
 func (n *Node) clearState() {
 	n.NodeState = NodeState{}
 }
@@ -102,14 +499,54 @@ func (n *Node) updateStatus(status NodeStatus) {
 	n.Status = status
 }
 
+// signal sends the signal to the process group of the step.
+// The signal given by SignalOnStop is sent instead if set.
 func (n *Node) signal(sig os.Signal) {
-	status := n.ReadStatus()
-	if status == NodeStatusRunning {
-		n.updateStatus(NodeStatusCancel)
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.Status == NodeStatusRunning {
+		n.Status = NodeStatusCancel
+	}
+	if n.pid == 0 {
+		return
+	}
+	s, ok := sig.(syscall.Signal)
+	if v, found := config.SignalByName(n.SignalOnStop); found {
+		s, ok = v, true
 	}
-	if n.cmd != nil {
-		n.cmd.Process.Signal(sig)
+	if !ok {
+		return
 	}
+	log.Printf("sending %s to %s", s, n.Name)
+	syscall.Kill(-n.pid, s)
+}
+
+// kill kills the process group of the step with SIGKILL
+// if it is still running.
+func (n *Node) kill() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.pid == 0 {
+		return
+	}
+	if n.Status == NodeStatusRunning {
+		n.Status = NodeStatusCancel
+	}
+	log.Printf("killing %s", n.Name)
+	n.ForceKilled = true
+	syscall.Kill(-n.pid, syscall.SIGKILL)
+}
+
+func (n *Node) hasProcess() bool {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return n.pid != 0
+}
+
+func (n *Node) readForceKilled() bool {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return n.ForceKilled
 }
 
 func (n *Node) cancel() {
@@ -119,17 +556,59 @@ func (n *Node) cancel() {
 	if status == NodeStatusNone || status == NodeStatusRunning {
 		n.Status = NodeStatusCancel
 	}
+	if n.Run != "" && n.pid != 0 {
+		// let the sub DAG agent stop its own steps
+		syscall.Kill(-n.pid, syscall.SIGTERM)
+		return
+	}
 	if n.cancelFunc != nil {
 		n.cancelFunc()
 	}
 }
 
-func (n *Node) setupLog(logDir string) {
+// setQueued sets the name of the pool the node is waiting for a slot
+// of, or clears it with an empty name.
+func (n *Node) setQueued(pool string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.queued = pool
+}
+
+func (n *Node) readQueued() string {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return n.queued
+}
+
+// StatusText returns the text of the status of the node. It tells
+// the pool while the node is waiting for a slot of it.
+func (n *Node) StatusText() string {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	if n.queued != "" {
+		return fmt.Sprintf("queued (pool %s)", n.queued)
+	}
+	return n.Status.String()
+}
+
+// setupLog sets the path of the log file of the step. The request ID
+// tells the logs of the runs started in the same second apart.
+func (n *Node) setupLog(logDir, requestId string) {
 	n.StartedAt = time.Now()
-	n.Log = filepath.Join(logDir, fmt.Sprintf("%s.%s.log",
+	name := fmt.Sprintf("%s.%s",
 		utils.ValidFilename(n.Name, "_"),
 		n.StartedAt.Format("20060102.15:04:05"),
-	))
+	)
+	if requestId != "" {
+		name = fmt.Sprintf("%s.%s", name, utils.ValidFilename(requestId, "_"))
+	}
+	n.Log = filepath.Join(logDir, name+".log")
+}
+
+// setRunEnv sets the variables of the run context
+// to pass to the command.
+func (n *Node) setRunEnv(env []string) {
+	n.runEnv = env
 }
 
 func (n *Node) openLogFile() error {
@@ -165,6 +644,26 @@ func (n *Node) ReadRetryCount() int {
 	return n.RetryCount
 }
 
+// readyToRetry returns false while the node is waiting
+// for the retry interval to pass.
+func (n *Node) readyToRetry() bool {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return !time.Now().Before(n.retryAt)
+}
+
+func (n *Node) readRetryAt() time.Time {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return n.retryAt
+}
+
+func (n *Node) setRetryAt(t time.Time) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.retryAt = t
+}
+
 func (n *Node) ReadDoneCount() int {
 	n.mu.RLock()
 	defer n.mu.RUnlock()
@@ -18,6 +18,39 @@ func TestExecute(t *testing.T) {
 	assert.Nil(t, n.Error)
 }
 
+func TestExecuteScript(t *testing.T) {
+	n := &scheduler.Node{
+		Step: &config.Step{
+			Script: "echo hello | grep -q hello && test \"$(echo a b)\" = \"a b\"",
+		}}
+	require.NoError(t, n.Execute())
+
+	script := "test 1 = 2\nexit 0\n"
+	n = &scheduler.Node{
+		Step: &config.Step{
+			Script: script,
+		}}
+	require.NoError(t, n.Execute())
+
+	n = &scheduler.Node{
+		Step: &config.Step{
+			Script: script,
+			Shell:  "sh -e",
+		}}
+	require.Error(t, n.Execute())
+	assert.Equal(t, 1, n.ExitCode)
+
+	// the arguments are the positional parameters of the script
+	n = &scheduler.Node{
+		Step: &config.Step{
+			Script:     "echo $1 \"$2\" | cat",
+			ScriptArgs: []string{"foo", "bar  baz"},
+			Output:     "OUT",
+		}}
+	require.NoError(t, n.Execute())
+	assert.Equal(t, "foo bar  baz", n.OutputValue)
+}
+
 func TestError(t *testing.T) {
 	n := &scheduler.Node{
 		Step: &config.Step{
@@ -4,11 +4,13 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/yohamta/dagu/internal/config"
 	"github.com/yohamta/dagu/internal/constants"
+	"github.com/yohamta/dagu/internal/pool"
 	"github.com/yohamta/dagu/internal/settings"
 )
 
@@ -21,6 +23,7 @@ const (
 	SchedulerStatus_Cancel
 	SchedulerStatus_Success
 	SchedulerStatus_Skipped_Unused
+	SchedulerStatus_Paused
 )
 
 func (s SchedulerStatus) String() string {
@@ -33,6 +36,8 @@ func (s SchedulerStatus) String() string {
 		return "canceled"
 	case SchedulerStatus_Success:
 		return "finished"
+	case SchedulerStatus_Paused:
+		return "paused"
 	case SchedulerStatus_None:
 		fallthrough
 	default:
@@ -40,6 +45,12 @@ func (s SchedulerStatus) String() string {
 	}
 }
 
+// IsRunning returns true if the DAG is running, including
+// when it is paused.
+func (s SchedulerStatus) IsRunning() bool {
+	return s == SchedulerStatus_Running || s == SchedulerStatus_Paused
+}
+
 type Scheduler struct {
 	*Config
 	canceled  int32
@@ -47,17 +58,32 @@ type Scheduler struct {
 	pause     time.Duration
 	lastError error
 	handlers  map[string]*Node
+	deadline  time.Time
+	// canceledCh is closed when the scheduler is canceled.
+	canceledCh chan struct{}
+	paused     bool
+	// resumedCh receives when the scheduler is resumed.
+	resumedCh chan struct{}
 }
 
 type Config struct {
-	LogDir        string
-	MaxActiveRuns int
-	Delay         time.Duration
-	Dry           bool
-	OnExit        *config.Step
-	OnSuccess     *config.Step
-	OnFailure     *config.Step
-	OnCancel      *config.Step
+	// Name, RequestId and SchedulerLogFile are passed
+	// to the steps as the variables of the run context.
+	Name             string
+	RequestId        string
+	SchedulerLogFile string
+	LogDir           string
+	MaxActiveRuns    int
+	Delay            time.Duration
+	Dry              bool
+	OnExit           *config.Step
+	OnSuccess        *config.Step
+	OnFailure        *config.Step
+	OnCancel         *config.Step
+	Timeout          time.Duration
+	// Pools are the pools shared across DAGs on the host,
+	// from which the steps with a pool take a slot to run.
+	Pools map[string]*pool.Pool
 }
 
 func New(config *Config) *Scheduler {
@@ -72,106 +98,29 @@ func (sc *Scheduler) Schedule(g *ExecutionGraph, done chan *Node) error {
 		return err
 	}
 	g.StartedAt = time.Now()
+	if sc.Timeout > 0 {
+		sc.deadline = g.StartedAt.Add(sc.Timeout)
+	}
 
 	defer func() {
 		g.FinishedAt = time.Now()
 	}()
 
-	var wg = sync.WaitGroup{}
+	newDispatcher(sc, g, done).run()
 
-	for !sc.isFinished(g) {
-		if sc.IsCanceled() {
-			break
-		}
+	if sc.isTimedOut() {
 		for _, node := range g.Nodes() {
-			if node.ReadStatus() != NodeStatusNone {
-				continue
-			}
-			if !isReady(g, node) {
-				continue
-			}
-			if sc.IsCanceled() {
-				break
-			}
-			if sc.MaxActiveRuns > 0 &&
-				sc.runningCount(g) >= sc.MaxActiveRuns {
-				continue
-			}
-			if len(node.Preconditions) > 0 {
-				log.Printf("checking pre conditions for \"%s\"", node.Name)
-				if err := config.EvalConditions(node.Preconditions); err != nil {
-					log.Printf("%s", err.Error())
-					node.updateStatus(NodeStatusSkipped)
-					node.Error = err
-					continue
-				}
+			if node.ReadStatus() == NodeStatusNone {
+				node.updateStatus(NodeStatusCancel)
+				node.Error = sc.timeoutError()
 			}
-			wg.Add(1)
-
-			log.Printf("start running: %s", node.Name)
-			node.updateStatus(NodeStatusRunning)
-			go func(node *Node) {
-				defer func() {
-					node.FinishedAt = time.Now()
-					wg.Done()
-				}()
-
-				if !sc.Dry {
-					node.setupLog(sc.LogDir)
-					node.openLogFile()
-					defer node.closeLogFile()
-				}
-
-				for !sc.IsCanceled() {
-					var err error = nil
-					if !sc.Dry {
-						err = node.Execute()
-					}
-					if err != nil {
-						handleError(node)
-						switch node.ReadStatus() {
-						case NodeStatusNone:
-							// nothing to do
-						case NodeStatusError:
-							sc.lastError = err
-						}
-					}
-					if node.ReadStatus() != NodeStatusCancel {
-						node.incDoneCount()
-					}
-					if node.RepeatPolicy.Repeat {
-						if err == nil || node.ContinueOn.Failure {
-							if !sc.IsCanceled() {
-								time.Sleep(node.RepeatPolicy.Interval)
-								continue
-							}
-						}
-					}
-					if err != nil {
-						if done != nil {
-							done <- node
-						}
-						return
-					}
-					break
-				}
-				if node.ReadStatus() == NodeStatusRunning {
-					node.updateStatus(NodeStatusSuccess)
-				}
-				if done != nil {
-					done <- node
-				}
-			}(node)
-
-			time.Sleep(sc.Delay)
 		}
-
-		time.Sleep(sc.pause)
 	}
-	wg.Wait()
+	sc.finishForeach(g, done)
 
 	handlers := []string{}
-	switch sc.Status(g) {
+	status := sc.Status(g)
+	switch status {
 	case SchedulerStatus_Success:
 		handlers = append(handlers, constants.OnSuccess)
 	case SchedulerStatus_Error:
@@ -180,22 +129,27 @@ func (sc *Scheduler) Schedule(g *ExecutionGraph, done chan *Node) error {
 		handlers = append(handlers, constants.OnCancel)
 	}
 	handlers = append(handlers, constants.OnExit)
+	handlerEnv := []string{
+		fmt.Sprintf("%s=%s", constants.EnvStatus, status),
+		fmt.Sprintf("%s=%s", constants.EnvFailedSteps, strings.Join(failedSteps(g), ",")),
+	}
 	for _, h := range handlers {
 		if n := sc.handlers[h]; n != nil {
 			log.Println(fmt.Sprintf("%s started", n.Name))
-			err := sc.runHandlerNode(n)
+			n.setOutputs(g.outputs())
+			err := sc.runHandlerNode(n, handlerEnv)
 			if err != nil {
-				sc.lastError = err
+				sc.setLastError(err)
 			}
 			if done != nil {
 				done <- n
 			}
 		}
 	}
-	return sc.lastError
+	return sc.readLastError()
 }
 
-func (sc *Scheduler) runHandlerNode(node *Node) error {
+func (sc *Scheduler) runHandlerNode(node *Node, env []string) error {
 	defer func() {
 		node.FinishedAt = time.Now()
 	}()
@@ -203,7 +157,17 @@ func (sc *Scheduler) runHandlerNode(node *Node) error {
 	node.updateStatus(NodeStatusRunning)
 
 	if !sc.Dry {
-		node.setupLog(sc.LogDir)
+		if node.Pool != "" {
+			slot, err := sc.waitSlot(node)
+			if err != nil {
+				node.Error = err
+				node.updateStatus(NodeStatusError)
+				return err
+			}
+			defer slot.Release()
+		}
+		node.setupLog(sc.LogDir, sc.RequestId)
+		node.setRunEnv(append(sc.runEnv(node), env...))
 		node.openLogFile()
 		defer node.closeLogFile()
 		err := node.Execute()
@@ -219,6 +183,62 @@ func (sc *Scheduler) runHandlerNode(node *Node) error {
 	return nil
 }
 
+// tryAcquireSlot takes a slot of the pool of the node if one is
+// free. It returns nil without an error when all of them are taken,
+// and marks the node as queued for the pool.
+func (sc *Scheduler) tryAcquireSlot(node *Node) (*pool.Slot, error) {
+	p, ok := sc.Pools[node.Pool]
+	if !ok {
+		return nil, fmt.Errorf("pool %s is not defined", node.Pool)
+	}
+	slot, err := p.TryAcquire()
+	if slot != nil || err != nil {
+		node.setQueued("")
+		return slot, err
+	}
+	if node.readQueued() == "" {
+		log.Printf("%s is queued for pool %s", node.Name, p.Name)
+		node.setQueued(p.Name)
+	}
+	return nil, nil
+}
+
+// waitSlot waits for a slot of the pool of the handler node. The
+// handlers run after the steps are canceled or timed out, so it
+// waits regardless of them.
+func (sc *Scheduler) waitSlot(node *Node) (*pool.Slot, error) {
+	for {
+		slot, err := sc.tryAcquireSlot(node)
+		if slot != nil || err != nil {
+			return slot, err
+		}
+		time.Sleep(sc.pause)
+	}
+}
+
+// runEnv returns the variables of the run context for the node.
+func (sc *Scheduler) runEnv(node *Node) []string {
+	return []string{
+		fmt.Sprintf("%s=%s", constants.EnvDAGName, sc.Name),
+		fmt.Sprintf("%s=%s", constants.EnvRequestId, sc.RequestId),
+		fmt.Sprintf("%s=%s", constants.EnvStepName, node.Name),
+		fmt.Sprintf("%s=%s", constants.EnvStepLogFile, node.Log),
+		fmt.Sprintf("%s=%s", constants.EnvSchedulerLogFile, sc.SchedulerLogFile),
+		fmt.Sprintf("%s=%d", constants.EnvStepRetryCount, node.ReadRetryCount()),
+	}
+}
+
+// failedSteps returns the names of the failed steps.
+func failedSteps(g *ExecutionGraph) []string {
+	var ret []string
+	for _, node := range g.Nodes() {
+		if node.ReadStatus() == NodeStatusError {
+			ret = append(ret, node.Name)
+		}
+	}
+	return ret
+}
+
 func (sc *Scheduler) setup() (err error) {
 	if sc.LogDir == "" {
 		sc.LogDir, err = settings.Get(settings.ConfigLogsDir)
@@ -231,35 +251,51 @@ func (sc *Scheduler) setup() (err error) {
 			return
 		}
 	}
-	sc.handlers = map[string]*Node{}
+	handlers := map[string]*Node{}
 	if sc.OnExit != nil {
-		sc.handlers[constants.OnExit] = &Node{Step: sc.OnExit}
+		handlers[constants.OnExit] = &Node{Step: sc.OnExit}
 	}
 	if sc.OnSuccess != nil {
-		sc.handlers[constants.OnSuccess] = &Node{Step: sc.OnSuccess}
+		handlers[constants.OnSuccess] = &Node{Step: sc.OnSuccess}
 	}
 	if sc.OnFailure != nil {
-		sc.handlers[constants.OnFailure] = &Node{Step: sc.OnFailure}
+		handlers[constants.OnFailure] = &Node{Step: sc.OnFailure}
 	}
 	if sc.OnCancel != nil {
-		sc.handlers[constants.OnCancel] = &Node{Step: sc.OnCancel}
+		handlers[constants.OnCancel] = &Node{Step: sc.OnCancel}
 	}
+	// the handlers are read while the steps run
+	sc.mu.Lock()
+	sc.handlers = handlers
+	sc.mu.Unlock()
 	return
 }
 
 func (sc *Scheduler) HanderNode(name string) *Node {
+	sc.mu.RLock()
+	defer sc.mu.RUnlock()
 	if v, ok := sc.handlers[name]; ok {
 		return v
 	}
 	return nil
 }
 
+// minRetryInterval is the interval to retry a step without
+// the interval so that a failing step is not retried in a loop.
+const minRetryInterval = 100 * time.Millisecond
+
 func handleError(node *Node) {
 	status := node.ReadStatus()
 	if status != NodeStatusCancel && status != NodeStatusSuccess {
-		if node.RetryPolicy != nil && node.RetryPolicy.Limit > node.ReadRetryCount() {
-			log.Printf("%s failed but scheduled for retry", node.Name)
+		if node.RetryPolicy != nil && node.RetryPolicy.Limit > node.ReadRetryCount() &&
+			node.RetryPolicy.Retryable(node.ExitCode) {
+			interval := node.RetryPolicy.IntervalFor(node.ReadRetryCount() + 1)
+			if interval < minRetryInterval {
+				interval = minRetryInterval
+			}
+			log.Printf("%s failed but scheduled for retry in %s", node.Name, interval)
 			node.incRetryCount()
+			node.setRetryAt(time.Now().Add(interval))
 			node.updateStatus(NodeStatusNone)
 		} else {
 			node.updateStatus(NodeStatusError)
@@ -267,6 +303,16 @@ func handleError(node *Node) {
 	}
 }
 
+// isTimedOut returns true when the DAG has been running
+// longer than the timeout.
+func (sc *Scheduler) isTimedOut() bool {
+	return !sc.deadline.IsZero() && !time.Now().Before(sc.deadline)
+}
+
+func (sc *Scheduler) timeoutError() error {
+	return fmt.Errorf("DAG timed out after %s", sc.Timeout)
+}
+
 func (sc *Scheduler) IsCanceled() bool {
 	sc.mu.RLock()
 	defer sc.mu.RUnlock()
@@ -277,7 +323,85 @@ func (sc *Scheduler) IsCanceled() bool {
 func (sc *Scheduler) setCanceled() {
 	sc.mu.Lock()
 	defer sc.mu.Unlock()
+	if sc.canceled == 1 {
+		return
+	}
 	sc.canceled = 1
+	if sc.canceledCh != nil {
+		close(sc.canceledCh)
+	}
+}
+
+func (sc *Scheduler) setLastError(err error) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	sc.lastError = err
+}
+
+func (sc *Scheduler) readLastError() error {
+	sc.mu.RLock()
+	defer sc.mu.RUnlock()
+	return sc.lastError
+}
+
+// Pause stops starting new steps. The running steps continue
+// to run until they finish.
+func (sc *Scheduler) Pause() {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	if !sc.paused {
+		log.Printf("pausing %s", sc.Name)
+		sc.paused = true
+	}
+}
+
+// Resume starts the steps ready to run again after Pause.
+func (sc *Scheduler) Resume() {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	if !sc.paused {
+		return
+	}
+	log.Printf("resuming %s", sc.Name)
+	sc.paused = false
+	select {
+	case sc.resumedChanLocked() <- struct{}{}:
+	default:
+	}
+}
+
+func (sc *Scheduler) IsPaused() bool {
+	sc.mu.RLock()
+	defer sc.mu.RUnlock()
+	return sc.paused
+}
+
+// resumedChan returns the channel that receives when the
+// scheduler is resumed.
+func (sc *Scheduler) resumedChan() <-chan struct{} {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	return sc.resumedChanLocked()
+}
+
+func (sc *Scheduler) resumedChanLocked() chan struct{} {
+	if sc.resumedCh == nil {
+		sc.resumedCh = make(chan struct{}, 1)
+	}
+	return sc.resumedCh
+}
+
+// canceledChan returns the channel closed when the scheduler is canceled.
+func (sc *Scheduler) canceledChan() <-chan struct{} {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	if sc.canceledCh == nil {
+		sc.canceledCh = make(chan struct{})
+		if sc.canceled == 1 {
+			close(sc.canceledCh)
+		}
+	}
+	return sc.canceledCh
 }
 
 func (sc *Scheduler) isRunning(g *ExecutionGraph) bool {
@@ -290,24 +414,43 @@ func (sc *Scheduler) isRunning(g *ExecutionGraph) bool {
 	return false
 }
 
-func (sc *Scheduler) runningCount(g *ExecutionGraph) (count int) {
-	count = 0
+// finishForeach updates the status of the running foreach nodes
+// whose children have all finished.
+func (sc *Scheduler) finishForeach(g *ExecutionGraph, done chan *Node) {
 	for _, node := range g.Nodes() {
-		switch node.ReadStatus() {
-		case NodeStatusRunning:
-			count++
+		if !node.IsForeach() || node.ReadStatus() != NodeStatusRunning {
+			continue
+		}
+		if sc.finishForeachNode(g, node) && done != nil {
+			done <- node
 		}
 	}
-	return count
 }
 
-func (sc *Scheduler) isFinished(g *ExecutionGraph) bool {
-	for _, node := range g.Nodes() {
-		switch node.ReadStatus() {
+// finishForeachNode updates the status of the foreach node if all of
+// its children have finished. A foreach node fails if any of the
+// children fails, and is canceled if any of them is canceled.
+// It returns true if the node has finished.
+func (sc *Scheduler) finishForeachNode(g *ExecutionGraph, node *Node) bool {
+	status := NodeStatusSuccess
+	for _, c := range g.Children(node) {
+		switch c.ReadStatus() {
 		case NodeStatusRunning, NodeStatusNone:
 			return false
+		case NodeStatusError:
+			status = NodeStatusError
+		case NodeStatusCancel:
+			if status == NodeStatusSuccess {
+				status = NodeStatusCancel
+			}
 		}
 	}
+	if status == NodeStatusError {
+		node.Error = fmt.Errorf("some of the items failed")
+	}
+	node.FinishedAt = time.Now()
+	node.incDoneCount()
+	node.updateStatus(status)
 	return true
 }
 
@@ -344,12 +487,31 @@ func (sc *Scheduler) Signal(g *ExecutionGraph, sig os.Signal, done chan bool) {
 		defer func() {
 			done <- true
 		}()
-		for sc.isRunning(g) {
+		// the steps are canceled before their processes exit
+		for sc.isRunning(g) || hasProcess(g) {
 			time.Sleep(sc.pause)
 		}
 	}
 }
 
+// hasProcess returns true if any of the processes of the steps is running.
+func hasProcess(g *ExecutionGraph) bool {
+	for _, node := range g.Nodes() {
+		if node.hasProcess() {
+			return true
+		}
+	}
+	return false
+}
+
+// Kill kills the steps still running with SIGKILL.
+func (sc *Scheduler) Kill(g *ExecutionGraph) {
+	sc.setCanceled()
+	for _, node := range g.Nodes() {
+		node.kill()
+	}
+}
+
 func (sc *Scheduler) Cancel(g *ExecutionGraph) {
 	sc.setCanceled()
 	for _, node := range g.Nodes() {
@@ -366,40 +528,14 @@ func (sc *Scheduler) Status(g *ExecutionGraph) SchedulerStatus {
 	if g.StartedAt.IsZero() {
 		return SchedulerStatus_None
 	}
+	if sc.IsPaused() && g.FinishedAt.IsZero() {
+		return SchedulerStatus_Paused
+	}
 	if sc.isRunning(g) {
 		return SchedulerStatus_Running
 	}
-	if sc.lastError != nil {
+	if sc.readLastError() != nil {
 		return SchedulerStatus_Error
 	}
 	return SchedulerStatus_Success
 }
-
-func isReady(g *ExecutionGraph, node *Node) (ready bool) {
-	ready = true
-	for _, dep := range g.To(node.id) {
-		n := g.Node(dep)
-		switch n.ReadStatus() {
-		case NodeStatusSuccess:
-			continue
-		case NodeStatusError:
-			if !n.ContinueOn.Failure {
-				ready = false
-				node.updateStatus(NodeStatusCancel)
-				node.Error = fmt.Errorf("upstream failed")
-			}
-		case NodeStatusSkipped:
-			if !n.ContinueOn.Skipped {
-				ready = false
-				node.updateStatus(NodeStatusSkipped)
-				node.Error = fmt.Errorf("upstream skipped")
-			}
-		case NodeStatusCancel:
-			ready = false
-			node.updateStatus(NodeStatusCancel)
-		default:
-			ready = false
-		}
-	}
-	return ready
-}
@@ -1,9 +1,11 @@
 package scheduler_test
 
 import (
+	"fmt"
 	"io/ioutil"
 	"os"
 	"path"
+	"strings"
 	"syscall"
 	"testing"
 	"time"
@@ -12,6 +14,7 @@ import (
 	"github.com/stretchr/testify/require"
 	"github.com/yohamta/dagu/internal/config"
 	"github.com/yohamta/dagu/internal/constants"
+	"github.com/yohamta/dagu/internal/pool"
 	"github.com/yohamta/dagu/internal/scheduler"
 	"github.com/yohamta/dagu/internal/settings"
 	"github.com/yohamta/dagu/internal/utils"
@@ -46,12 +49,16 @@ func TestScheduler(t *testing.T) {
 
 	counter := 0
 	done := make(chan *scheduler.Node)
+	finished := make(chan bool)
 	go func() {
 		for range done {
 			counter += 1
 		}
+		finished <- true
 	}()
 	require.Error(t, sc.Schedule(g, done))
+	close(done)
+	<-finished
 	assert.Equal(t, counter, 3)
 	assert.Equal(t, sc.Status(g), scheduler.SchedulerStatus_Error)
 
@@ -173,6 +180,40 @@ func TestSchedulerCancel(t *testing.T) {
 	assert.Equal(t, scheduler.NodeStatusCancel, nodes[2].Status)
 }
 
+func TestSchedulerPause(t *testing.T) {
+	g, _ := scheduler.NewExecutionGraph(
+		step("1", "sleep 0.5"),
+		step("2", testCommand, "1"),
+	)
+	sc := scheduler.New(&scheduler.Config{
+		MaxActiveRuns: 1,
+	})
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- sc.Schedule(g, nil)
+	}()
+
+	nodes := g.Nodes()
+	require.Eventually(t, func() bool {
+		return nodes[0].ReadStatus() == scheduler.NodeStatusRunning
+	}, time.Second*3, time.Millisecond*10)
+	sc.Pause()
+
+	// the running step finishes but the next one does not start
+	require.Eventually(t, func() bool {
+		return nodes[0].ReadStatus() == scheduler.NodeStatusSuccess
+	}, time.Second*3, time.Millisecond*50)
+	<-time.After(time.Millisecond * 200)
+	assert.Equal(t, scheduler.SchedulerStatus_Paused, sc.Status(g))
+	assert.Equal(t, scheduler.NodeStatusNone, nodes[1].ReadStatus())
+
+	sc.Resume()
+	require.NoError(t, <-errs)
+	assert.Equal(t, scheduler.SchedulerStatus_Success, sc.Status(g))
+	assert.Equal(t, scheduler.NodeStatusSuccess, g.Nodes()[1].ReadStatus())
+}
+
 func TestSchedulerRetryFail(t *testing.T) {
 	cmd := path.Join(testBinDir, "testfile.sh")
 	g, sc, err := testSchedule(t,
@@ -249,6 +290,51 @@ func TestSchedulerRetrySuccess(t *testing.T) {
 	}
 }
 
+func TestSchedulerRetryPolicy(t *testing.T) {
+	cmd := path.Join(testBinDir, "exit.sh")
+	policy := &config.RetryPolicy{
+		Limit:     2,
+		Interval:  time.Millisecond * 100,
+		Backoff:   2,
+		ExitCodes: []int{2},
+	}
+	start := time.Now()
+	g, sc, err := testSchedule(t,
+		&config.Step{
+			Name:        "1",
+			Command:     cmd,
+			Args:        []string{"1"},
+			RetryPolicy: policy,
+		},
+		&config.Step{
+			Name:        "2",
+			Command:     cmd,
+			Args:        []string{"2"},
+			RetryPolicy: policy,
+		},
+	)
+	require.Error(t, err)
+	assert.Equal(t, sc.Status(g), scheduler.SchedulerStatus_Error)
+	// 100ms and 200ms for the retries of step 2
+	assert.GreaterOrEqual(t, time.Since(start), time.Millisecond*300)
+
+	nodes := g.Nodes()
+	assert.Equal(t, scheduler.NodeStatusError, nodes[0].ReadStatus())
+	assert.Equal(t, 0, nodes[0].ReadRetryCount())
+	assert.Equal(t, 1, nodes[0].ExitCode)
+	require.Len(t, nodes[0].Attempts, 1)
+
+	assert.Equal(t, scheduler.NodeStatusError, nodes[1].ReadStatus())
+	assert.Equal(t, 2, nodes[1].ReadRetryCount())
+	require.Len(t, nodes[1].Attempts, 3)
+	for i, a := range nodes[1].Attempts {
+		assert.Equal(t, 2, a.ExitCode)
+		if i > 0 {
+			assert.True(t, a.StartedAt.After(nodes[1].Attempts[i-1].StartedAt))
+		}
+	}
+}
+
 func TestStepPreCondition(t *testing.T) {
 	g, sc, err := testSchedule(t,
 		step("1", testCommand),
@@ -285,6 +371,437 @@ func TestStepPreCondition(t *testing.T) {
 	assert.Equal(t, scheduler.NodeStatusSkipped, nodes[2].ReadStatus())
 	assert.Equal(t, scheduler.NodeStatusSuccess, nodes[3].ReadStatus())
 	assert.Equal(t, scheduler.NodeStatusSuccess, nodes[4].ReadStatus())
+
+	require.Len(t, nodes[1].ConditionResults, 1)
+	assert.False(t, nodes[1].ConditionResults[0].Met)
+	assert.Equal(t, "1", nodes[1].ConditionResults[0].Actual)
+	require.Len(t, nodes[3].ConditionResults, 1)
+	assert.True(t, nodes[3].ConditionResults[0].Met)
+}
+
+func TestSchedulerOutput(t *testing.T) {
+	s1 := step("1", "echo "+testDir)
+	s1.Output = "OUT1"
+	s2 := &config.Step{
+		Name:    "2",
+		Command: "echo",
+		Args:    []string{"$OUT1"},
+		Dir:     "${OUT1}",
+		Depends: []string{"1"},
+		Output:  "OUT2",
+	}
+	s3 := step("3", testCommand, "2")
+	s3.Preconditions = []*config.Condition{
+		{
+			Condition: "$OUT2",
+			Expected:  testDir,
+		},
+	}
+	g, sc, err := testSchedule(t, s1, s2, s3)
+	require.NoError(t, err)
+	assert.Equal(t, sc.Status(g), scheduler.SchedulerStatus_Success)
+
+	nodes := g.Nodes()
+	assert.Equal(t, testDir, nodes[0].OutputValue)
+	assert.Equal(t, testDir, nodes[1].OutputValue)
+	assert.Equal(t, scheduler.NodeStatusSuccess, nodes[2].ReadStatus())
+}
+
+func TestSchedulerForeach(t *testing.T) {
+	s1 := step("1", "echo b c b")
+	s1.Output = "ITEMS"
+	s2 := &config.Step{
+		Name:    "2",
+		Command: "sh",
+		Args:    []string{"-c", "echo ${ITEM} > " + path.Join(testDir, "foreach_${ITEM}")},
+		Foreach: []string{"a"},
+		Depends: []string{"1"},
+	}
+	s3 := &config.Step{
+		Name:        "3",
+		Command:     "sleep",
+		Args:        []string{"1"},
+		ForeachFrom: "${ITEMS}",
+		MaxParallel: 1,
+		Depends:     []string{"1"},
+	}
+	s4 := step("4", testCommand, "2", "3")
+	g, sc, err := testSchedule(t, s1, s2, s3, s4)
+	require.NoError(t, err)
+	assert.Equal(t, sc.Status(g), scheduler.SchedulerStatus_Success)
+
+	nodes := g.Nodes()
+	require.Len(t, nodes, 7)
+	for _, n := range nodes {
+		assert.Equal(t, scheduler.NodeStatusSuccess, n.ReadStatus(), n.Name)
+	}
+
+	b, err := os.ReadFile(path.Join(testDir, "foreach_a"))
+	require.NoError(t, err)
+	assert.Equal(t, "a\n", string(b))
+
+	children := g.Children(nodes[2])
+	require.Len(t, children, 2)
+	assert.Equal(t, "3[b]", children[0].Name)
+	assert.Equal(t, "c", children[1].Item)
+	// the items run one by one with maxParallel
+	assert.False(t, children[1].StartedAt.Before(children[0].FinishedAt))
+	// the downstream step waits for all the items
+	assert.False(t, nodes[3].StartedAt.Before(children[1].FinishedAt))
+}
+
+func TestSchedulerForeachFail(t *testing.T) {
+	s1 := step("1", path.Join(testBinDir, "exit.sh"))
+	s1.Args = []string{"${ITEM}"}
+	s1.Foreach = []string{"0", "1"}
+	g, sc, err := testSchedule(t, s1, step("2", testCommand, "1"))
+	require.Error(t, err)
+	assert.Equal(t, sc.Status(g), scheduler.SchedulerStatus_Error)
+
+	nodes := g.Nodes()
+	assert.Equal(t, scheduler.NodeStatusError, nodes[0].ReadStatus())
+	assert.Equal(t, scheduler.NodeStatusCancel, nodes[1].ReadStatus())
+	assert.Equal(t, scheduler.NodeStatusSuccess, nodes[2].ReadStatus())
+	assert.Equal(t, scheduler.NodeStatusError, nodes[3].ReadStatus())
+
+	// the items are expanded again on retry
+	g, err = scheduler.RetryExecutionGraph(nodes...)
+	require.NoError(t, err)
+	require.Len(t, g.Nodes(), 2)
+}
+
+func TestSchedulerSecrets(t *testing.T) {
+	s1 := &config.Step{
+		Name:    "1",
+		Command: "echo",
+		Args:    []string{"${secret:TOKEN}", "${PASSWORD}"},
+		Output:  "OUT",
+		Secrets: []string{"PASSWORD=secret-password", "TOKEN=secret-token"},
+	}
+	s2 := &config.Step{
+		Name:    "2",
+		Command: "sh",
+		Args:    []string{"-c", `test "$TOKEN" = secret-token`},
+		Depends: []string{"1"},
+		Secrets: []string{"TOKEN=secret-token"},
+		Preconditions: []*config.Condition{
+			{Condition: "${TOKEN}", Expected: "secret-token"},
+			// the output is passed to the downstream steps as it is
+			{Condition: "${OUT}", Expected: "secret-token secret-password"},
+		},
+	}
+	g, sc, err := testSchedule(t, s1, s2)
+	require.NoError(t, err)
+	assert.Equal(t, sc.Status(g), scheduler.SchedulerStatus_Success)
+
+	nodes := g.Nodes()
+	assert.Equal(t, "secret-token secret-password", nodes[0].OutputValue)
+	b, err := os.ReadFile(nodes[0].Log)
+	require.NoError(t, err)
+	assert.Equal(t, "*** ***\n", string(b))
+	assert.Equal(t, "***", nodes[1].ConditionResults[0].Actual)
+}
+
+func TestSchedulerRunEnv(t *testing.T) {
+	s1 := &config.Step{
+		Name:    "1",
+		Command: "sh",
+		Args: []string{"-c", `echo "$DAG_NAME,$DAG_REQUEST_ID,$DAG_STEP_NAME,` +
+			`$DAG_STEP_LOG_FILE,$DAG_SCHEDULER_LOG_FILE,$DAG_STEP_RETRY_COUNT"`},
+		Output: "OUT",
+	}
+	s2 := &config.Step{
+		Name:        "2",
+		Command:     "sh",
+		Args:        []string{"-c", `echo $DAG_STEP_RETRY_COUNT; exit 1`},
+		Output:      "RETRY",
+		RetryPolicy: &config.RetryPolicy{Limit: 1},
+	}
+	g, sc := newTestSchedule(t,
+		&scheduler.Config{
+			Name:             "test DAG",
+			RequestId:        "request-id",
+			SchedulerLogFile: "/tmp/scheduler.log",
+			OnFailure: &config.Step{
+				Name:    constants.OnFailure,
+				Command: "sh",
+				Args:    []string{"-c", `echo "$DAG_STATUS,$DAG_FAILED_STEPS,$DAG_STEP_NAME"`},
+				Output:  "HANDLER",
+			},
+		},
+		s1, s2,
+	)
+	err := sc.Schedule(g, nil)
+	require.Error(t, err)
+
+	nodes := g.Nodes()
+	assert.Equal(t, fmt.Sprintf("test DAG,request-id,1,%s,/tmp/scheduler.log,0",
+		nodes[0].Log), nodes[0].OutputValue)
+	assert.Equal(t, "1", nodes[1].OutputValue)
+	assert.Equal(t, "failed,2,onFailure",
+		sc.HanderNode(constants.OnFailure).OutputValue)
+}
+
+func TestSchedulerInheritEnv(t *testing.T) {
+	os.Setenv("INHERIT_ALLOWED", "allowed")
+	os.Setenv("INHERIT_DENIED", "denied")
+	defer os.Unsetenv("INHERIT_ALLOWED")
+	defer os.Unsetenv("INHERIT_DENIED")
+
+	command := []string{"-c", `echo "$INHERIT_ALLOWED,$INHERIT_DENIED,$STEP_VAR"`}
+	s1 := &config.Step{
+		Name:       "1",
+		Command:    "sh",
+		Args:       command,
+		Output:     "OUT1",
+		Variables:  []string{"STEP_VAR=step"},
+		InheritEnv: &config.InheritEnv{Allow: []string{"INHERIT_*"}, Deny: []string{"*_DENIED"}},
+	}
+	s2 := &config.Step{
+		Name:    "2",
+		Command: "sh",
+		Args:    command,
+		Output:  "OUT2",
+	}
+	g, sc, err := testSchedule(t, s1, s2)
+	require.NoError(t, err)
+	assert.Equal(t, sc.Status(g), scheduler.SchedulerStatus_Success)
+
+	nodes := g.Nodes()
+	assert.Equal(t, "allowed,,step", nodes[0].OutputValue)
+	assert.Equal(t, ",,", nodes[1].OutputValue)
+}
+
+func TestSchedulerStepTimeout(t *testing.T) {
+	s1 := step("1", "sleep 3")
+	s1.Timeout = time.Millisecond * 500
+	g, sc := newTestSchedule(t,
+		&scheduler.Config{
+			OnExit:    step("onExit", testCommand),
+			OnFailure: step("onFailure", testCommand),
+		},
+		s1,
+		step("2", testCommand, "1"),
+	)
+
+	start := time.Now()
+	err := sc.Schedule(g, nil)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "timed out")
+	assert.Less(t, time.Since(start), time.Second*2)
+	assert.Equal(t, sc.Status(g), scheduler.SchedulerStatus_Error)
+
+	nodes := g.Nodes()
+	assert.Equal(t, scheduler.NodeStatusError, nodes[0].ReadStatus())
+	assert.Contains(t, nodes[0].Error.Error(), "step timed out")
+	assert.Equal(t, scheduler.NodeStatusCancel, nodes[1].ReadStatus())
+	assert.Equal(t, scheduler.NodeStatusSuccess, sc.HanderNode(constants.OnFailure).ReadStatus())
+	assert.Equal(t, scheduler.NodeStatusSuccess, sc.HanderNode(constants.OnExit).ReadStatus())
+}
+
+func TestSchedulerTimeout(t *testing.T) {
+	g, sc := newTestSchedule(t,
+		&scheduler.Config{
+			Timeout:       time.Millisecond * 500,
+			MaxActiveRuns: 1,
+			OnExit:        step("onExit", testCommand),
+			OnFailure:     step("onFailure", testCommand),
+		},
+		step("1", "sleep 3"),
+		step("2", testCommand),
+	)
+
+	start := time.Now()
+	err := sc.Schedule(g, nil)
+	require.Error(t, err)
+	assert.Less(t, time.Since(start), time.Second*2)
+	assert.Equal(t, sc.Status(g), scheduler.SchedulerStatus_Error)
+
+	nodes := g.Nodes()
+	assert.Equal(t, scheduler.NodeStatusError, nodes[0].ReadStatus())
+	assert.Contains(t, nodes[0].Error.Error(), "DAG timed out")
+	assert.Equal(t, scheduler.NodeStatusCancel, nodes[1].ReadStatus())
+	assert.Equal(t, scheduler.NodeStatusSuccess, sc.HanderNode(constants.OnFailure).ReadStatus())
+	assert.Equal(t, scheduler.NodeStatusSuccess, sc.HanderNode(constants.OnExit).ReadStatus())
+}
+
+func TestSchedulerKillNestedProcesses(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		setup func(c *scheduler.Config, s *config.Step)
+		stop  func(sc *scheduler.Scheduler, g *scheduler.ExecutionGraph)
+	}{
+		{
+			name: "cancel",
+			stop: func(sc *scheduler.Scheduler, g *scheduler.ExecutionGraph) {
+				sc.Cancel(g)
+			},
+		},
+		{
+			name: "signal",
+			stop: func(sc *scheduler.Scheduler, g *scheduler.ExecutionGraph) {
+				sc.Signal(g, syscall.SIGTERM, nil)
+			},
+		},
+		{
+			name: "step timeout",
+			setup: func(_ *scheduler.Config, s *config.Step) {
+				s.Timeout = time.Millisecond * 500
+			},
+		},
+		{
+			name: "DAG timeout",
+			setup: func(c *scheduler.Config, _ *config.Step) {
+				c.Timeout = time.Millisecond * 500
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			pidFile := path.Join(t.TempDir(), "pid")
+			s := &config.Step{
+				Name:   "1",
+				Script: fmt.Sprintf("sh -c 'sleep 60 & echo $! > %s; wait'", pidFile),
+			}
+			c := &scheduler.Config{MaxActiveRuns: 1}
+			if tc.setup != nil {
+				tc.setup(c, s)
+			}
+			g, sc := newTestSchedule(t, c, s)
+
+			pidCh := make(chan int, 1)
+			go func() {
+				pid := waitPid(t, pidFile)
+				if tc.stop != nil {
+					tc.stop(sc, g)
+				}
+				pidCh <- pid
+			}()
+
+			start := time.Now()
+			_ = sc.Schedule(g, nil)
+			assert.Less(t, time.Since(start), time.Second*5)
+			pid := <-pidCh
+			require.NotZero(t, pid)
+			require.Eventually(t, func() bool {
+				return !processAlive(pid)
+			}, time.Second*2, time.Millisecond*50)
+		})
+	}
+}
+
+// waitPid waits for the pid of the nested process to be written.
+func waitPid(t *testing.T, pidFile string) int {
+	t.Helper()
+	for i := 0; i < 100; i++ {
+		var pid int
+		if b, err := os.ReadFile(pidFile); err == nil {
+			if _, err := fmt.Sscan(string(b), &pid); err == nil {
+				return pid
+			}
+		}
+		time.Sleep(time.Millisecond * 50)
+	}
+	return 0
+}
+
+// processAlive returns true if the process exists and is not a zombie.
+func processAlive(pid int) bool {
+	b, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return syscall.Kill(pid, 0) == nil && !os.IsNotExist(err)
+	}
+	fields := strings.Fields(string(b))
+	return len(fields) > 2 && fields[2] != "Z"
+}
+
+func TestSchedulerPool(t *testing.T) {
+	dir := path.Join(testDir, "pools")
+	pools := map[string]*pool.Pool{"db": pool.New(dir, "db", 1)}
+	schedule := func(s ...*config.Step) (*scheduler.ExecutionGraph, *scheduler.Scheduler, chan error) {
+		g, sc := newTestSchedule(t, &scheduler.Config{Pools: pools, MaxActiveRuns: 1}, s...)
+		errs := make(chan error, 1)
+		go func() {
+			errs <- sc.Schedule(g, nil)
+		}()
+		return g, sc, errs
+	}
+	queued := func(g *scheduler.ExecutionGraph) func() bool {
+		return func() bool {
+			return g.Nodes()[0].StatusText() == "queued (pool db)"
+		}
+	}
+
+	// the slot is taken by another DAG
+	slot, err := pool.New(dir, "db", 1).TryAcquire()
+	require.NoError(t, err)
+	require.NotNil(t, slot)
+
+	s1 := step("1", testCommand)
+	s1.Pool = "db"
+	g, sc, errs := schedule(s1, step("other", testCommand))
+	require.Eventually(t, queued(g), time.Second*3, time.Millisecond*50)
+	// the step waiting for the pool does not take the slot of
+	// maxActiveRuns from the other step
+	require.Eventually(t, func() bool {
+		return g.Nodes()[1].ReadStatus() == scheduler.NodeStatusSuccess
+	}, time.Second*3, time.Millisecond*50)
+	require.Equal(t, scheduler.NodeStatusNone, g.Nodes()[0].ReadStatus())
+	require.NoError(t, slot.Release())
+	require.NoError(t, <-errs)
+	require.Equal(t, scheduler.SchedulerStatus_Success, sc.Status(g))
+
+	// paused while waiting for the slot
+	slot, err = pool.New(dir, "db", 1).TryAcquire()
+	require.NoError(t, err)
+	s4 := step("4", testCommand)
+	s4.Pool = "db"
+	g, sc, errs = schedule(s4)
+	require.Eventually(t, queued(g), time.Second*3, time.Millisecond*50)
+	sc.Pause()
+	require.NoError(t, slot.Release())
+	time.Sleep(time.Millisecond * 300)
+	require.Equal(t, scheduler.NodeStatusNone, g.Nodes()[0].ReadStatus())
+	sc.Resume()
+	require.NoError(t, <-errs)
+	require.Equal(t, scheduler.NodeStatusSuccess, g.Nodes()[0].ReadStatus())
+
+	// the handlers take the slots too
+	slot, err = pool.New(dir, "db", 1).TryAcquire()
+	require.NoError(t, err)
+	onExit := step("onExit", testCommand)
+	onExit.Pool = "db"
+	g, sc = newTestSchedule(t, &scheduler.Config{Pools: pools, OnExit: onExit},
+		step("5", testCommand))
+	errs = make(chan error, 1)
+	go func() {
+		errs <- sc.Schedule(g, nil)
+	}()
+	require.Eventually(t, func() bool {
+		return sc.HanderNode(constants.OnExit).StatusText() == "queued (pool db)"
+	}, time.Second*3, time.Millisecond*50)
+	require.NoError(t, slot.Release())
+	require.NoError(t, <-errs)
+	require.Equal(t, scheduler.NodeStatusSuccess, sc.HanderNode(constants.OnExit).ReadStatus())
+
+	// canceled while waiting for the slot
+	slot, err = pool.New(dir, "db", 1).TryAcquire()
+	require.NoError(t, err)
+	defer slot.Release()
+
+	s2 := step("2", testCommand)
+	s2.Pool = "db"
+	g, sc, errs = schedule(s2)
+	require.Eventually(t, queued(g), time.Second*3, time.Millisecond*50)
+	sc.Signal(g, syscall.SIGTERM, nil)
+	require.NoError(t, <-errs)
+	require.Equal(t, scheduler.SchedulerStatus_Cancel, sc.Status(g))
+	require.Equal(t, scheduler.NodeStatusCancel, g.Nodes()[0].ReadStatus())
+
+	s3 := step("3", testCommand)
+	s3.Pool = "unknown"
+	g, sc, errs = schedule(s3)
+	require.Error(t, <-errs)
+	require.Equal(t, scheduler.NodeStatusError, g.Nodes()[0].ReadStatus())
 }
 
 func TestSchedulerOnExit(t *testing.T) {
@@ -526,7 +1043,7 @@ func TestSchedulerStatusText(t *testing.T) {
 }
 
 func step(name, command string, depends ...string) *config.Step {
-	cmd, args := utils.SplitCommand(command)
+	cmd, args, _ := utils.SplitCommand(command)
 	return &config.Step{
 		Name:    name,
 		Command: cmd,
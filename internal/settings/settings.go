@@ -13,11 +13,17 @@ var ErrConfigNotFound = fmt.Errorf("config not found")
 var cache map[string]string = nil
 
 const (
-	ConfigDataDir   = "DAGU__DATA"
-	ConfigLogsDir   = "DAGU__LOGS"
-	ConfigAdminPort = "CONFIG__ADMIN_PORT"
+	ConfigDataDir        = "DAGU__DATA"
+	ConfigLogsDir        = "DAGU__LOGS"
+	ConfigAdminPort      = "CONFIG__ADMIN_PORT"
+	ConfigExecutable     = "DAGU__EXECUTABLE"
+	ConfigSecretsKeyFile = "DAGU__SECRETS_KEY_FILE"
 )
 
+// SecretsKeyEnv is the environment variable to give the key to decrypt
+// the secrets files instead of the key file. It is not cached.
+const SecretsKeyEnv = "DAGU__SECRETS_KEY"
+
 func MustGet(name string) string {
 	val, err := Get(name)
 	if err != nil {
@@ -47,6 +53,9 @@ func load() {
 	cache[ConfigLogsDir] = config(ConfigLogsDir,
 		path.Join(dir, "/.dagu/logs"))
 	cache[ConfigAdminPort] = config(ConfigAdminPort, "8000")
+	cache[ConfigExecutable] = config(ConfigExecutable, executable())
+	cache[ConfigSecretsKeyFile] = config(ConfigSecretsKeyFile,
+		path.Join(dir, "/.dagu/secrets.key"))
 }
 
 func InitTest(dir string) {
@@ -54,6 +63,14 @@ func InitTest(dir string) {
 	load()
 }
 
+func executable() string {
+	exe, err := os.Executable()
+	if err != nil {
+		return "dagu"
+	}
+	return exe
+}
+
 func config(env, def string) string {
 	val := os.ExpandEnv(fmt.Sprintf("${%s}", env))
 	if val == "" {
@@ -2,9 +2,13 @@ package sock
 
 import (
 	"crypto/md5"
+	"errors"
 	"fmt"
+	"net"
 	"path"
+	"path/filepath"
 	"strings"
+	"syscall"
 )
 
 const sockDir = "/tmp"
@@ -17,3 +21,37 @@ func GetSockAddr(key string) string {
 	bs := h.Sum(nil)
 	return path.Join(sockDir, fmt.Sprintf("@dagu-%s-%x", name, bs))
 }
+
+// GetInstanceSockAddr returns the address of the socket of a run of
+// the DAG that runs in parallel with the other runs. It starts with
+// the address of GetSockAddr, and ends with the hash of the request ID.
+func GetInstanceSockAddr(key, requestId string) string {
+	h := md5.New()
+	h.Write([]byte(requestId))
+	return fmt.Sprintf("%s-%x", GetSockAddr(key), h.Sum(nil)[:4])
+}
+
+// InstanceSockAddrs returns the addresses of the sockets of the runs
+// of the DAG running in parallel.
+func InstanceSockAddrs(key string) []string {
+	matches, _ := filepath.Glob(GetSockAddr(key) + "-*")
+	return matches
+}
+
+// OrphanedSockets returns the socket files of agents that
+// are not listened on anymore.
+func OrphanedSockets() []string {
+	ret := []string{}
+	matches, _ := filepath.Glob(path.Join(sockDir, "@dagu-*"))
+	for _, m := range matches {
+		conn, err := net.DialTimeout("unix", m, timeout)
+		if err == nil {
+			conn.Close()
+			continue
+		}
+		if errors.Is(err, syscall.ECONNREFUSED) {
+			ret = append(ret, m)
+		}
+	}
+	return ret
+}
@@ -0,0 +1,26 @@
+package sock_test
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/yohamta/dagu/internal/sock"
+)
+
+func TestInstanceSockAddr(t *testing.T) {
+	key := "/tmp/test_instance_sock_addr.yaml"
+	a1 := sock.GetInstanceSockAddr(key, "request-1")
+	a2 := sock.GetInstanceSockAddr(key, "request-2")
+	require.NotEqual(t, a1, a2)
+	require.True(t, strings.HasPrefix(a1, sock.GetSockAddr(key)+"-"))
+
+	for _, a := range []string{a1, a2, sock.GetSockAddr(key)} {
+		f, err := os.Create(a)
+		require.NoError(t, err)
+		f.Close()
+		defer os.Remove(a)
+	}
+	require.ElementsMatch(t, []string{a1, a2}, sock.InstanceSockAddrs(key))
+}
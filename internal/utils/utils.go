@@ -1,14 +1,18 @@
 package utils
 
 import (
+	"errors"
+	"fmt"
 	"io/ioutil"
 	"log"
 	"os"
 	"os/exec"
 	"regexp"
 	"strings"
+	"syscall"
 	"time"
 
+	"github.com/mattn/go-shellwords"
 	"github.com/yohamta/dagu/internal/constants"
 )
 
@@ -55,12 +59,55 @@ func FormatDuration(t time.Duration, defaultVal string) string {
 	}
 }
 
-func SplitCommand(cmd string) (program string, args []string) {
-	vals := strings.SplitN(os.ExpandEnv(cmd), " ", 2)
-	if len(vals) > 1 {
-		return vals[0], strings.Split(vals[1], " ")
+// ErrShellOperators is returned when the command has shell
+// operators such as pipes and redirects, which need a shell to run.
+var ErrShellOperators = errors.New("shell operators are not supported")
+
+// SplitCommand splits the command into the program and the arguments
+// in the same way as a shell does with quotes and escapes, and then
+// expands the environment variables in each of them. The values of
+// the variables are neither parsed nor split into words. Shell
+// operators such as pipes and redirects are not supported.
+func SplitCommand(cmd string) (program string, args []string, err error) {
+	return SplitCommandWith(cmd, os.ExpandEnv)
+}
+
+// SplitCommandWith is like SplitCommand but expands
+// the program and the arguments with expand.
+func SplitCommandWith(cmd string, expand func(string) string) (program string, args []string, err error) {
+	program, args, err = SplitArgs(cmd)
+	if err != nil {
+		return "", nil, err
+	}
+	for i := range args {
+		args[i] = expand(args[i])
+	}
+	return expand(program), args, nil
+}
+
+// SplitArgs is like SplitCommand but does not expand
+// the environment variables.
+func SplitArgs(cmd string) (program string, args []string, err error) {
+	p := shellwords.NewParser()
+	vals, err := p.Parse(cmd)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to parse command %q: %w", cmd, err)
+	}
+	if p.Position >= 0 {
+		return "", nil, fmt.Errorf("%w in command %q", ErrShellOperators, cmd)
+	}
+	if len(vals) == 0 {
+		return "", nil, fmt.Errorf("command is empty")
 	}
-	return vals[0], []string{}
+	return vals[0], vals[1:], nil
+}
+
+var variableNameMatcher = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// IsValidVariableName returns true if the name can be used
+// as the name of an environment variable.
+func IsValidVariableName(name string) bool {
+	return variableNameMatcher.MatchString(name)
 }
 
 func FileExists(file string) bool {
@@ -104,33 +151,86 @@ func ValidFilename(str, replacement string) string {
 }
 
 func ParseVariable(value string) (string, error) {
-	val, err := ParseCommand(os.ExpandEnv(value))
-	if err != nil {
-		return "", err
+	return ParseVariableWithEnv(value, nil)
+}
+
+// ParseVariableWithEnv is like ParseVariable but looks up the variables
+// in env first, and runs the command substitutions with env added to
+// the environment of the process. The variables outside the command
+// substitutions are expanded, and the commands expand the variables
+// in their arguments after they are parsed.
+func ParseVariableWithEnv(value string, env []string) (string, error) {
+	return substituteCommands(value, env, func(s string) string {
+		return ExpandEnvWith(s, env)
+	})
+}
+
+// ParseVariableWith is like ParseVariableWithEnv but expands the
+// variables outside the command substitutions with expand.
+func ParseVariableWith(value string, env []string, expand func(string) string) (string, error) {
+	return substituteCommands(value, env, expand)
+}
+
+// ExpandEnvWith replaces ${var} or $var in the string with the variables
+// in env given as KEY=VALUE, and with the environment of the process
+// for the ones not in env. Later variables in env take precedence.
+func ExpandEnvWith(s string, env []string) string {
+	if len(env) == 0 {
+		return os.ExpandEnv(s)
 	}
-	return val, nil
+	return os.Expand(s, func(k string) string {
+		for i := len(env) - 1; i >= 0; i-- {
+			if strings.HasPrefix(env[i], k+"=") {
+				return env[i][len(k)+1:]
+			}
+		}
+		return os.Getenv(k)
+	})
 }
 
 var tickerMatcher = regexp.MustCompile("`[^`]+`")
 
 func ParseCommand(value string) (string, error) {
-	matches := tickerMatcher.FindAllString(strings.TrimSpace(value), -1)
-	if matches == nil {
-		return value, nil
-	}
-	ret := value
-	for i := 0; i < len(matches); i++ {
-		command := matches[i]
-		str := strings.ReplaceAll(command, "`", "")
-		prog, args := SplitCommand(str)
-		out, err := exec.Command(prog, args...).Output()
+	return ParseCommandWithEnv(value, nil)
+}
+
+// ParseCommandWithEnv is like ParseCommand but runs the commands
+// with env added to the environment of the process.
+func ParseCommandWithEnv(value string, env []string) (string, error) {
+	return substituteCommands(value, env, func(s string) string { return s })
+}
+
+// substituteCommands replaces the commands in backquotes in the value
+// with their output, and the rest of the value with the result of
+// expand. The commands with shell operators are run by sh.
+func substituteCommands(value string, env []string, expand func(string) string) (string, error) {
+	var b strings.Builder
+	last := 0
+	for _, m := range tickerMatcher.FindAllStringIndex(value, -1) {
+		b.WriteString(expand(value[last:m[0]]))
+		str := value[m[0]+1 : m[1]-1]
+		prog, args, err := SplitCommandWith(str, func(s string) string {
+			return ExpandEnvWith(s, env)
+		})
+		if errors.Is(err, ErrShellOperators) {
+			prog, args, err = "sh", []string{"-c", str}, nil
+		}
 		if err != nil {
 			return "", err
 		}
-		ret = strings.ReplaceAll(ret, command, strings.TrimSpace(string(out[:])))
-
+		cmd := exec.Command(prog, args...)
+		if len(env) > 0 {
+			cmd.Env = append(os.Environ(), env...)
+		}
+		out, err := cmd.Output()
+		if err != nil {
+			return "", err
+		}
+		b.WriteString(strings.TrimSpace(string(out)))
+		last = m[1]
 	}
-	return ret, nil
+	b.WriteString(expand(value[last:]))
+	return b.String(), nil
 }
 
 func MustTempDir(pattern string) string {
@@ -146,3 +246,42 @@ func LogIgnoreErr(action string, err error) {
 		log.Printf("%s failed. %s", action, err)
 	}
 }
+
+// ProcessStartToken returns a token that identifies the process
+// together with its pid, made of the boot ID of the machine and the
+// start time of the process. It returns an empty string when they
+// can not be read.
+func ProcessStartToken(pid int) string {
+	bootId, err := ioutil.ReadFile("/proc/sys/kernel/random/boot_id")
+	if err != nil {
+		return ""
+	}
+	stat, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return ""
+	}
+	// the fields after the command name, which may contain spaces
+	s := string(stat)
+	fields := strings.Fields(s[strings.LastIndex(s, ")")+1:])
+	if len(fields) < 20 {
+		return ""
+	}
+	return fmt.Sprintf("%s-%s", strings.TrimSpace(string(bootId)), fields[19])
+}
+
+// IsProcessAlive returns true if the process of the pid is running.
+// The process is considered to be another one when the token is not
+// empty and differs from the start token of the process.
+func IsProcessAlive(pid int, token string) bool {
+	if pid <= 0 {
+		return false
+	}
+	if err := syscall.Kill(pid, 0); err != nil && err != syscall.EPERM {
+		return false
+	}
+	if token == "" {
+		return true
+	}
+	t := ProcessStartToken(pid)
+	return t == "" || t == token
+}
@@ -7,6 +7,7 @@ import (
 	"io/ioutil"
 	"log"
 	"os"
+	"os/exec"
 	"path"
 	"testing"
 	"time"
@@ -58,10 +59,59 @@ func TestFormatDuration(t *testing.T) {
 
 func TestSplitCommand(t *testing.T) {
 	command := "ls -al test/"
-	program, args := utils.SplitCommand(command)
+	program, args, err := utils.SplitCommand(command)
+	require.NoError(t, err)
 	assert.Equal(t, "ls", program)
 	assert.Equal(t, "-al", args[0])
 	assert.Equal(t, "test/", args[1])
+
+	program, args, err = utils.SplitCommand(`echo "hello world" 'a  b' c\ d`)
+	require.NoError(t, err)
+	assert.Equal(t, "echo", program)
+	assert.Equal(t, []string{"hello world", "a  b", "c d"}, args)
+
+	// the variables are expanded after the command is parsed
+	os.Setenv("TEST_SPLIT_URL", "http://x?a=1&b=2")
+	os.Setenv("TEST_SPLIT_QUOTE", "it's")
+	program, args, err = utils.SplitCommand(`curl $TEST_SPLIT_URL "${TEST_SPLIT_QUOTE} a"`)
+	require.NoError(t, err)
+	assert.Equal(t, "curl", program)
+	assert.Equal(t, []string{"http://x?a=1&b=2", "it's a"}, args)
+
+	for _, c := range []string{
+		`echo "hello`,
+		"",
+	} {
+		_, _, err = utils.SplitCommand(c)
+		require.Error(t, err, c)
+	}
+
+	for _, c := range []string{
+		"echo a | grep a",
+		"true && false",
+		"echo a > /dev/null",
+		"true; false",
+	} {
+		_, _, err = utils.SplitCommand(c)
+		require.ErrorIs(t, err, utils.ErrShellOperators, c)
+	}
+}
+
+func TestSplitArgs(t *testing.T) {
+	os.Setenv("TEST_SPLIT_ARGS", "a")
+	program, args, err := utils.SplitArgs("echo ${TEST_SPLIT_ARGS}")
+	require.NoError(t, err)
+	assert.Equal(t, "echo", program)
+	assert.Equal(t, []string{"${TEST_SPLIT_ARGS}"}, args)
+}
+
+func TestIsValidVariableName(t *testing.T) {
+	for _, n := range []string{"A", "_a1", "DATE_FROM"} {
+		assert.True(t, utils.IsValidVariableName(n), n)
+	}
+	for _, n := range []string{"", "1A", "A-B", "A B"} {
+		assert.False(t, utils.IsValidVariableName(n), n)
+	}
 }
 
 func TestFileExits(t *testing.T) {
@@ -130,6 +180,29 @@ func TestParseVariable(t *testing.T) {
 	assert.Equal(t, r, "test")
 }
 
+func TestParseVariableWithEnv(t *testing.T) {
+	os.Setenv("TEST_VAR", "test")
+	env := []string{"TEST_VAR_1=a", "TEST_VAR_2=b", "TEST_VAR_1=c"}
+
+	r, err := utils.ParseVariableWithEnv("${TEST_VAR_1}/${TEST_VAR_2}/${TEST_VAR}", env)
+	require.NoError(t, err)
+	assert.Equal(t, "c/b/test", r)
+
+	r, err = utils.ParseVariableWithEnv("`printenv TEST_VAR_2`", env)
+	require.NoError(t, err)
+	assert.Equal(t, "b", r)
+	assert.Equal(t, "", os.Getenv("TEST_VAR_2"))
+
+	// the values are passed to the command as they are
+	r, err = utils.ParseVariableWithEnv("${TEST_VAR_3}-`printf %s ${TEST_VAR_3}`", []string{"TEST_VAR_3=it's a&b"})
+	require.NoError(t, err)
+	assert.Equal(t, "it's a&b-it's a&b", r)
+
+	r, err = utils.ParseVariableWithEnv("`echo a | tr a ${TEST_VAR_2}`", env)
+	require.NoError(t, err)
+	assert.Equal(t, "b", r)
+}
+
 func TestMustTempDir(t *testing.T) {
 	dir := utils.MustTempDir("tempdir")
 	defer os.RemoveAll(dir)
@@ -183,3 +256,17 @@ func TestIgnoreErr(t *testing.T) {
 	require.Contains(t, s, "test action failed")
 	require.Contains(t, s, "test error")
 }
+
+func TestIsProcessAlive(t *testing.T) {
+	pid := os.Getpid()
+	token := utils.ProcessStartToken(pid)
+	require.NotEqual(t, "", token)
+	require.True(t, utils.IsProcessAlive(pid, token))
+	require.True(t, utils.IsProcessAlive(pid, ""))
+	require.False(t, utils.IsProcessAlive(pid, "other"))
+	require.False(t, utils.IsProcessAlive(-1, ""))
+
+	cmd := exec.Command("true")
+	require.NoError(t, cmd.Run())
+	require.False(t, utils.IsProcessAlive(cmd.Process.Pid, ""))
+}